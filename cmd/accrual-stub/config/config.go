@@ -0,0 +1,53 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"strconv"
+	"time"
+)
+
+var Options struct {
+	HostAddr   string
+	Rules      string
+	StageTime  time.Duration
+	RateLimit  int
+	ErrorRate  float64
+	RetryAfter int
+}
+
+func InitConfig() {
+	initFlags()
+	initEnv()
+}
+
+func initFlags() {
+	flag.StringVar(&Options.HostAddr, "a", ":8080", "Адрес и порт запуска сервиса")
+	flag.StringVar(&Options.Rules, "rules", "0=invalid,9=none,*=100", "Правила вознаграждения по окончанию номера заказа")
+	flag.DurationVar(&Options.StageTime, "stage", 2*time.Second, "Время нахождения заказа в каждом промежуточном статусе")
+	flag.IntVar(&Options.RateLimit, "rate-limit", 0, "Допустимое число запросов в минуту, 0 - без ограничений")
+	flag.Float64Var(&Options.ErrorRate, "error-rate", 0, "Доля запросов, на которые отвечать 500")
+	flag.IntVar(&Options.RetryAfter, "retry-after", 60, "Значение заголовка Retry-After при ответе 429")
+	flag.Parse()
+}
+
+func initEnv() {
+	if envHostAddr := os.Getenv("RUN_ADDRESS"); envHostAddr != "" {
+		Options.HostAddr = envHostAddr
+	}
+	if envRules := os.Getenv("ACCRUAL_RULES"); envRules != "" {
+		Options.Rules = envRules
+	}
+	if envStageTime, err := time.ParseDuration(os.Getenv("ACCRUAL_STAGE_TIME")); err == nil {
+		Options.StageTime = envStageTime
+	}
+	if envRateLimit, err := strconv.Atoi(os.Getenv("ACCRUAL_RATE_LIMIT")); err == nil {
+		Options.RateLimit = envRateLimit
+	}
+	if envErrorRate, err := strconv.ParseFloat(os.Getenv("ACCRUAL_ERROR_RATE"), 64); err == nil {
+		Options.ErrorRate = envErrorRate
+	}
+	if envRetryAfter, err := strconv.Atoi(os.Getenv("ACCRUAL_RETRY_AFTER")); err == nil {
+		Options.RetryAfter = envRetryAfter
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/yury-kuznetsov/gofermart/cmd/accrual-stub/config"
+	"log"
+	"net/http"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+func main() {
+	config.InitConfig()
+
+	rules, err := parseRules(config.Options.Rules)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	s := newStub(
+		rules,
+		config.Options.StageTime,
+		config.Options.RateLimit,
+		config.Options.ErrorRate,
+		config.Options.RetryAfter,
+	)
+	server := &http.Server{Addr: config.Options.HostAddr, Handler: s.router()}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		err := server.ListenAndServe()
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Printf("HTTP server ListenAndServe: %v", err)
+			stop()
+		}
+	}()
+
+	<-ctx.Done()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		fmt.Printf("HTTP server Shutdown: %v", err)
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/yury-kuznetsov/gofermart/internal/balance/model"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// особые значения правил вознаграждения
+const (
+	rewardInvalid = "invalid" // заказ не будет принят к расчёту
+	rewardNone    = "none"    // заказ не зарегистрирован, ответ 204
+)
+
+// rule задаёт результат расчёта для номеров с указанным окончанием
+type rule struct {
+	suffix string
+	reward string
+	sum    model.Money
+}
+
+// parseRules разбирает правила вида "0=invalid,9=none,77=729.98,*=100".
+// Побеждает правило с самым длинным совпавшим окончанием, "*" подходит к любому номеру.
+func parseRules(s string) ([]rule, error) {
+	var rules []rule
+	for _, item := range strings.Split(s, ",") {
+		suffix, reward, ok := strings.Cut(strings.TrimSpace(item), "=")
+		if !ok {
+			return nil, fmt.Errorf("некорректное правило %q", item)
+		}
+
+		r := rule{suffix: strings.TrimPrefix(suffix, "*"), reward: reward}
+		if reward != rewardInvalid && reward != rewardNone {
+			sum, err := model.ParseMoney(reward)
+			if err != nil {
+				return nil, err
+			}
+			r.sum = sum
+		}
+		rules = append(rules, r)
+	}
+
+	sort.SliceStable(rules, func(i, j int) bool {
+		return len(rules[i].suffix) > len(rules[j].suffix)
+	})
+
+	return rules, nil
+}
+
+func match(rules []rule, number string) (rule, bool) {
+	for _, r := range rules {
+		if strings.HasSuffix(number, r.suffix) {
+			return r, true
+		}
+	}
+	return rule{}, false
+}
+
+type stub struct {
+	rules      []rule
+	stageTime  time.Duration
+	rateLimit  int
+	errorRate  float64
+	retryAfter int
+
+	mu sync.Mutex
+	// момент первого запроса по заказу, от него отсчитывается смена статусов
+	seen map[string]time.Time
+	// запросы в текущую минуту
+	window   time.Time
+	requests int
+}
+
+func newStub(rules []rule, stageTime time.Duration, rateLimit int, errorRate float64, retryAfter int) *stub {
+	return &stub{
+		rules:      rules,
+		stageTime:  stageTime,
+		rateLimit:  rateLimit,
+		errorRate:  errorRate,
+		retryAfter: retryAfter,
+		seen:       make(map[string]time.Time),
+	}
+}
+
+func (s *stub) router() http.Handler {
+	r := chi.NewRouter()
+	r.Get("/api/orders/{number}", s.getOrderHandler)
+	return r
+}
+
+func (s *stub) getOrderHandler(w http.ResponseWriter, r *http.Request) {
+	number := chi.URLParam(r, "number")
+	now := time.Now()
+
+	// ограничение количества запросов
+	if !s.allow(now) {
+		w.Header().Set("Retry-After", strconv.Itoa(s.retryAfter))
+		http.Error(w, fmt.Sprintf("No more than %d requests per minute allowed", s.rateLimit), http.StatusTooManyRequests)
+		return
+	}
+
+	// имитация сбоя системы расчёта
+	if s.errorRate > 0 && rand.Float64() < s.errorRate {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	result, ok := s.result(number, now)
+	if !ok {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	w.Header().Set("content-type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// allow считает запрос в окне длиной в минуту, начатом первым запросом после предыдущего окна
+func (s *stub) allow(now time.Time) bool {
+	if s.rateLimit <= 0 {
+		return true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now.Sub(s.window) >= time.Minute {
+		s.window = now
+		s.requests = 0
+	}
+	s.requests++
+
+	return s.requests <= s.rateLimit
+}
+
+// result возвращает статус заказа: REGISTERED -> PROCESSING -> PROCESSED/INVALID
+func (s *stub) result(number string, now time.Time) (model.AccrualResult, bool) {
+	r, ok := match(s.rules, number)
+	if !ok || r.reward == rewardNone {
+		return model.AccrualResult{}, false
+	}
+
+	s.mu.Lock()
+	first, seen := s.seen[number]
+	if !seen {
+		first = now
+		s.seen[number] = now
+	}
+	s.mu.Unlock()
+
+	result := model.AccrualResult{Order: number}
+	switch elapsed := now.Sub(first); {
+	case elapsed < s.stageTime:
+		result.Status = model.AccrualRegistered
+	case elapsed < 2*s.stageTime:
+		result.Status = model.AccrualProcessing
+	case r.reward == rewardInvalid:
+		result.Status = model.AccrualInvalid
+	default:
+		result.Status = model.AccrualProcessed
+		sum := r.sum
+		result.Accrual = &sum
+	}
+
+	return result, true
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yury-kuznetsov/gofermart/internal/balance/model"
+	"testing"
+	"time"
+)
+
+func TestParseRules(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules string
+		want  []rule
+		error bool
+	}{
+		{
+			name:  "SortedBySuffixLength",
+			rules: "0=invalid, 9=none,77=729.98,*=100",
+			want: []rule{
+				{suffix: "77", reward: "729.98", sum: 72998},
+				{suffix: "0", reward: rewardInvalid},
+				{suffix: "9", reward: rewardNone},
+				{suffix: "", reward: "100", sum: 100 * model.Point},
+			},
+		},
+		{
+			name:  "MissingReward",
+			rules: "0",
+			error: true,
+		},
+		{
+			name:  "IncorrectSum",
+			rules: "1=много",
+			error: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := parseRules(tt.rules)
+			if tt.error {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, rules)
+		})
+	}
+}
+
+func TestMatch(t *testing.T) {
+	rules, err := parseRules("0=invalid,9=none,77=729.98,*=100")
+	require.NoError(t, err)
+
+	tests := []struct {
+		number string
+		reward string
+	}{
+		{number: "12345678903", reward: "100"},
+		{number: "1230", reward: rewardInvalid},
+		{number: "1239", reward: rewardNone},
+		{number: "1277", reward: "729.98"},
+		{number: "1207", reward: "100"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.number, func(t *testing.T) {
+			r, ok := match(rules, tt.number)
+			assert.True(t, ok)
+			assert.Equal(t, tt.reward, r.reward)
+		})
+	}
+
+	// без правила "*" подходят только перечисленные окончания
+	rules, err = parseRules("0=invalid")
+	require.NoError(t, err)
+	_, ok := match(rules, "1231")
+	assert.False(t, ok)
+}
+
+func TestResult(t *testing.T) {
+	rules, err := parseRules("0=invalid,9=none,*=729.98")
+	require.NoError(t, err)
+	start := time.Now()
+	sum := model.Money(72998)
+
+	tests := []struct {
+		name    string
+		number  string
+		elapsed time.Duration
+		status  string
+		accrual *model.Money
+		found   bool
+	}{
+		{name: "NotRegistered", number: "1239", found: false},
+		{name: "Registered", number: "1231", elapsed: 0, status: model.AccrualRegistered, found: true},
+		{name: "Processing", number: "1231", elapsed: 15 * time.Second, status: model.AccrualProcessing, found: true},
+		{name: "Processed", number: "1231", elapsed: 25 * time.Second, status: model.AccrualProcessed, accrual: &sum, found: true},
+		{name: "Invalid", number: "1230", elapsed: 25 * time.Second, status: model.AccrualInvalid, found: true},
+	}
+
+	s := newStub(rules, 10*time.Second, 0, 0, 60)
+	// первый запрос по каждому заказу запускает отсчёт стадий
+	s.result("1231", start)
+	s.result("1230", start)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, ok := s.result(tt.number, start.Add(tt.elapsed))
+			assert.Equal(t, tt.found, ok)
+			if !ok {
+				return
+			}
+			assert.Equal(t, tt.number, result.Order)
+			assert.Equal(t, tt.status, result.Status)
+			assert.Equal(t, tt.accrual, result.Accrual)
+		})
+	}
+}
+
+func TestAllow(t *testing.T) {
+	start := time.Now()
+
+	tests := []struct {
+		name      string
+		rateLimit int
+		requests  []time.Duration
+		want      []bool
+	}{
+		{
+			name:      "Unlimited",
+			rateLimit: 0,
+			requests:  []time.Duration{0, 0, 0},
+			want:      []bool{true, true, true},
+		},
+		{
+			name:      "LimitWithinMinute",
+			rateLimit: 2,
+			requests:  []time.Duration{0, time.Second, 59 * time.Second},
+			want:      []bool{true, true, false},
+		},
+		{
+			name:      "NextMinute",
+			rateLimit: 1,
+			requests:  []time.Duration{0, 30 * time.Second, time.Minute, time.Minute + time.Second},
+			want:      []bool{true, false, true, false},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newStub(nil, time.Second, tt.rateLimit, 0, 60)
+			var got []bool
+			for _, offset := range tt.requests {
+				got = append(got, s.allow(start.Add(offset)))
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"expvar"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"log"
+	"net"
+	"net/http"
+)
+
+// adminHandler отдаёт служебные метрики expvar на отдельном адресе, недоступном клиентам сервиса.
+// Переменная cmdline не публикуется: в аргументах запуска бывает адрес базы данных с паролем.
+func adminHandler() http.Handler {
+	r := chi.NewRouter()
+	r.Get("/debug/vars", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		fmt.Fprint(w, "{\n")
+		first := true
+		expvar.Do(func(kv expvar.KeyValue) {
+			if kv.Key == "cmdline" {
+				return
+			}
+			if !first {
+				fmt.Fprint(w, ",\n")
+			}
+			first = false
+			fmt.Fprintf(w, "%q: %s", kv.Key, kv.Value)
+		})
+		fmt.Fprint(w, "\n}\n")
+	})
+
+	return r
+}
+
+// warnPublicAdmin предупреждает, если служебный адрес доступен не только с этого сервера
+func warnPublicAdmin(addr string) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return
+	}
+	if host == "localhost" {
+		return
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return
+	}
+
+	log.Printf("служебный адрес %s доступен не только локально, метрики может прочитать любой клиент сети", addr)
+}
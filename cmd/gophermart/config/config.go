@@ -3,12 +3,35 @@ package config
 import (
 	"flag"
 	"os"
+	"strconv"
+	"time"
 )
 
+// NotifyLog вместо файла уведомлений включает их запись в журнал сервиса
+const NotifyLog = "log"
+
 var Options struct {
 	HostAddr     string
 	DatabaseAddr string
 	AccrualAddr  string
+	SyncWorkers  int
+
+	// ключи подписи токенов: файл с набором ключей или секрет HS256
+	JWTKeysFile string
+	JWTSecret   string
+
+	// файл для уведомлений пользователям или NotifyLog, чтобы писать их в журнал;
+	// без него сброс пароля отключён
+	NotifyFile string
+
+	// адрес служебного сервера с метриками (/debug/vars), без него метрики не публикуются
+	AdminAddr string
+
+	// адреса и подсети прокси через запятую, которым доверяется адрес клиента
+	// из X-Forwarded-For и X-Real-IP; без них адрес берётся из соединения
+	TrustedProxies string
+
+	ShutdownTimeout time.Duration
 }
 
 func InitConfig() {
@@ -20,6 +43,12 @@ func initFlags() {
 	flag.StringVar(&Options.HostAddr, "a", ":8081", "Адрес и порт запуска сервиса")
 	flag.StringVar(&Options.DatabaseAddr, "d", "", "Адрес подключения к базе данных")
 	flag.StringVar(&Options.AccrualAddr, "r", ":8080", "Адрес системы расчёта начислений")
+	flag.IntVar(&Options.SyncWorkers, "w", 4, "Количество обработчиков синхронизации начислений")
+	flag.StringVar(&Options.JWTKeysFile, "k", "", "Файл ключей подписи токенов")
+	flag.StringVar(&Options.NotifyFile, "n", "", "Файл уведомлений пользователям (сброс пароля) или log для записи в журнал")
+	flag.StringVar(&Options.AdminAddr, "m", "", "Адрес служебного сервера метрик, например 127.0.0.1:9090")
+	flag.StringVar(&Options.TrustedProxies, "p", "", "Доверенные прокси через запятую: адреса или подсети CIDR")
+	flag.DurationVar(&Options.ShutdownTimeout, "t", 5*time.Second, "Время на мягкое завершение работы")
 	flag.Parse()
 }
 
@@ -33,4 +62,24 @@ func initEnv() {
 	if envAccrualAddr := os.Getenv("ACCRUAL_SYSTEM_ADDRESS"); envAccrualAddr != "" {
 		Options.AccrualAddr = envAccrualAddr
 	}
+	if envSyncWorkers, err := strconv.Atoi(os.Getenv("SYNC_WORKERS")); err == nil {
+		Options.SyncWorkers = envSyncWorkers
+	}
+	if envJWTKeysFile := os.Getenv("JWT_KEYS_FILE"); envJWTKeysFile != "" {
+		Options.JWTKeysFile = envJWTKeysFile
+	}
+	// секрет передаётся только через окружение, чтобы не светиться в списке процессов
+	Options.JWTSecret = os.Getenv("JWT_SECRET")
+	if envNotifyFile := os.Getenv("NOTIFY_FILE"); envNotifyFile != "" {
+		Options.NotifyFile = envNotifyFile
+	}
+	if envAdminAddr := os.Getenv("ADMIN_ADDRESS"); envAdminAddr != "" {
+		Options.AdminAddr = envAdminAddr
+	}
+	if envTrustedProxies := os.Getenv("TRUSTED_PROXIES"); envTrustedProxies != "" {
+		Options.TrustedProxies = envTrustedProxies
+	}
+	if envShutdownTimeout, err := time.ParseDuration(os.Getenv("SHUTDOWN_TIMEOUT")); err == nil {
+		Options.ShutdownTimeout = envShutdownTimeout
+	}
 }
@@ -2,94 +2,238 @@ package main
 
 import (
 	"context"
-	"database/sql"
 	"errors"
+	"flag"
 	"fmt"
 	"github.com/go-chi/chi/v5"
-	_ "github.com/jackc/pgx/v5/stdlib"
 	"github.com/yury-kuznetsov/gofermart/cmd/gophermart/config"
-	balanceRepository "github.com/yury-kuznetsov/gofermart/internal/balance/repository"
 	balanceService "github.com/yury-kuznetsov/gofermart/internal/balance/service"
 	"github.com/yury-kuznetsov/gofermart/internal/handlers"
-	userRepository "github.com/yury-kuznetsov/gofermart/internal/user/repository"
+	"github.com/yury-kuznetsov/gofermart/internal/migrations"
+	userNotifier "github.com/yury-kuznetsov/gofermart/internal/user/notifier"
 	userService "github.com/yury-kuznetsov/gofermart/internal/user/service"
 	"github.com/yury-kuznetsov/gofermart/middleware"
 	"log"
 	"net/http"
-	"os"
+	"net/netip"
 	"os/signal"
 	"syscall"
-	"time"
 )
 
 func main() {
 	config.InitConfig()
 
-	// создаем сервер
-	server := &http.Server{Addr: config.Options.HostAddr, Handler: service()}
+	// без адреса базы данных работаем с хранилищем в памяти
+	if config.Options.DatabaseAddr == "" {
+		if flag.Arg(0) == "migrate" {
+			log.Fatal("для миграций нужен адрес базы данных (-d или DATABASE_URI)")
+		}
+		repos, err := memoryRepositories(context.Background())
+		if err != nil {
+			log.Fatal(err)
+		}
+		run(repos)
+		return
+	}
+
+	db, newRepositories, err := openDatabase(config.Options.DatabaseAddr)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	migrator, err := migrations.NewMigrator(db)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// подкоманда управления схемой базы данных
+	if flag.Arg(0) == "migrate" {
+		if err := migrate(context.Background(), migrator, flag.Args()[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// сервис работает только со схемой, на которую рассчитан
+	if err := migrator.Check(context.Background()); err != nil {
+		log.Fatal(err)
+	}
+
+	run(newRepositories(db))
+}
+
+func run(repos repositories) {
+	keys, err := tokenKeys()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	trustedProxies, err := middleware.ParseTrustedProxies(config.Options.TrustedProxies)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	// готовим канал для прослушивания системных сигналов
-	stop := make(chan os.Signal, 1)
-	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	// контекст отменяется при получении системного сигнала остановки
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// создаем сервер и фоновую синхронизацию начислений
+	handler, syncSrv := service(repos, keys, trustedProxies)
+	server := &http.Server{Addr: config.Options.HostAddr, Handler: handler}
 
 	// запускаем сервера в отдельной горутине
 	go func() {
 		err := server.ListenAndServe()
 		if err != nil && !errors.Is(err, http.ErrServerClosed) {
 			fmt.Printf("HTTP server ListenAndServe: %v", err)
+			stop()
 		}
 	}()
 
-	// ожидаем сигнала остановки из канала `stop`
-	<-stop
+	// служебный сервер с метриками запускается, только если задан его адрес
+	var admin *http.Server
+	if config.Options.AdminAddr != "" {
+		warnPublicAdmin(config.Options.AdminAddr)
+		admin = &http.Server{Addr: config.Options.AdminAddr, Handler: adminHandler()}
+		go func() {
+			err := admin.ListenAndServe()
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				fmt.Printf("Admin server ListenAndServe: %v", err)
+				stop()
+			}
+		}()
+	}
+
+	// запускаем синхронизацию: по сигналу остановки она перестаёт брать новые заказы,
+	// а начатые прерываются, только если не успели завершиться за отведённое время
+	orderCtx, cancelOrders := context.WithCancel(context.Background())
+	defer cancelOrders()
+	syncDone := make(chan struct{})
+	go func() {
+		syncSrv.Start(ctx, orderCtx)
+		close(syncDone)
+	}()
 
-	// даем серверу 5 секунд на завершение обработки текущих запросов
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	// ожидаем сигнала остановки
+	<-ctx.Done()
+
+	// даем серверу и обработчикам время на завершение текущих запросов и заказов
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), config.Options.ShutdownTimeout)
 	defer cancel()
 
 	// завершаем "мягко" работу сервера
-	if err := server.Shutdown(ctx); err != nil {
+	if err := server.Shutdown(shutdownCtx); err != nil {
 		fmt.Printf("HTTP server Shutdown: %v", err)
 	}
+	if admin != nil {
+		if err := admin.Shutdown(shutdownCtx); err != nil {
+			fmt.Printf("Admin server Shutdown: %v", err)
+		}
+	}
+
+	// дожидаемся обработчиков синхронизации в пределах того же времени
+	select {
+	case <-syncDone:
+	case <-shutdownCtx.Done():
+		cancelOrders()
+		fmt.Println("Sync service Shutdown: не дождались завершения обработки заказов, они прерваны")
+	}
 }
 
-func service() http.Handler {
-	r := chi.NewRouter()
-	r.Use(middleware.GzipMiddleware)
+// tokenKeys загружает ключи подписи токенов: из файла, из секрета или, если ничего не задано, случайный
+func tokenKeys() (*userService.KeySet, error) {
+	switch {
+	case config.Options.JWTKeysFile != "":
+		return userService.LoadKeySet(config.Options.JWTKeysFile)
+	case config.Options.JWTSecret != "":
+		return userService.NewSecretKeySet(config.Options.JWTSecret)
+	default:
+		log.Println("ключ подписи токенов не задан (-k, JWT_KEYS_FILE или JWT_SECRET), " +
+			"используется случайный: токены перестанут действовать после перезапуска")
+		return userService.RandomKeySet(), nil
+	}
+}
 
-	db, err := sql.Open("pgx", config.Options.DatabaseAddr)
-	if err != nil {
-		log.Fatal(err)
+// notifier выбирает способ доставки уведомлений пользователям. Без него сброс пароля отключён:
+// токены сброса дают доступ к учётной записи, и молча писать их в журнал нельзя.
+func notifier() userService.Notifier {
+	switch config.Options.NotifyFile {
+	case "":
+		log.Println("способ доставки уведомлений не задан (-n или NOTIFY_FILE), сброс пароля отключён")
+		return nil
+	case config.NotifyLog:
+		log.Println("ВНИМАНИЕ: токены сброса пароля пишутся в журнал сервиса, " +
+			"любой, кто читает журнал, может сменить пароль пользователя; только для локальной работы")
+		return userNotifier.LogNotifier{}
+	default:
+		return userNotifier.NewFileNotifier(config.Options.NotifyFile)
 	}
+}
+
+func service(
+	repos repositories,
+	keys *userService.KeySet,
+	trustedProxies []netip.Prefix,
+) (http.Handler, balanceService.SyncService) {
+	r := chi.NewRouter()
+	r.Use(middleware.RealIPMiddleware(trustedProxies))
+	r.Use(middleware.GzipMiddleware)
 
 	// сервисы аутентификации
-	userRepo := userRepository.NewUserRepository(db)
-	userSvc := userService.NewUserService(userRepo)
-	jwtSvc := userService.NewTokenService()
+	userSvc := userService.NewUserService(repos.user)
+	jwtSvc := userService.NewTokenService(keys, repos.revocation)
+	refreshSvc := userService.NewRefreshService(repos.tx, repos.refreshToken)
+	loginGuard := userService.NewLoginGuard(repos.loginAttempt)
+	passwordSvc := userService.NewPasswordService(
+		repos.tx,
+		repos.user,
+		repos.passwordReset,
+		repos.resetRequest,
+		notifier(),
+		refreshSvc,
+		jwtSvc,
+	)
 
 	// сервис отображения баланса
-	balanceRepo := balanceRepository.NewBalanceRepository(db)
-	balanceSrv := balanceService.NewBalanceService(balanceRepo)
-
-	// сервис начисления баланса
-	accrualRepo := balanceRepository.NewAccrualRepository(db)
-	accrualSrv := balanceService.NewAccrualService(balanceRepo, accrualRepo)
+	balanceSrv := balanceService.NewBalanceService(repos.balance)
+
+	// сервис начисления баланса и его синхронизация с системой расчёта
+	accrualSrv := balanceService.NewAccrualService(repos.accrual)
+	syncSrv := balanceService.NewSyncService(
+		repos.tx,
+		repos.ledger,
+		repos.accrual,
+		balanceService.NewHTTPAccrualClient(config.Options.AccrualAddr),
+		config.Options.SyncWorkers,
+	)
 
 	// сервис списания баланса
-	withdrawalRepo := balanceRepository.NewWithdrawalRepository(db)
-	withdrawSrv := balanceService.NewWithdrawalService(balanceRepo, withdrawalRepo)
+	withdrawSrv := balanceService.NewWithdrawalService(repos.tx, repos.balance, repos.ledger, repos.withdrawal)
+
+	// сервис выписки по счёту
+	statementSrv := balanceService.NewStatementService(repos.tx, repos.statement)
+
+	r.Post("/api/user/register", handlers.RegisterHandler(userSvc, jwtSvc, refreshSvc))
+	r.Post("/api/user/login", handlers.LoginHandler(userSvc, jwtSvc, refreshSvc, loginGuard))
+	r.Post("/api/user/token/refresh", handlers.RefreshHandler(jwtSvc, refreshSvc))
+	r.Post("/api/user/password/reset/request", handlers.RequestPasswordResetHandler(passwordSvc))
+	r.Post("/api/user/password/reset", handlers.ResetPasswordHandler(passwordSvc))
 
-	r.Post("/api/user/register", handlers.RegisterHandler(userSvc, jwtSvc))
-	r.Post("/api/user/login", handlers.LoginHandler(userSvc, jwtSvc))
+	// открытые ключи для проверки токенов другими сервисами
+	r.Get("/.well-known/jwks.json", handlers.JWKSHandler(jwtSvc))
 
 	r.Group(func(r chi.Router) {
 		r.Use(middleware.AuthMiddleware(jwtSvc))
+		r.Post("/api/user/logout", handlers.LogoutHandler(jwtSvc, refreshSvc))
+		r.Post("/api/user/logout-all", handlers.LogoutAllHandler(jwtSvc, refreshSvc))
+		r.Post("/api/user/password", handlers.ChangePasswordHandler(passwordSvc, jwtSvc, refreshSvc))
 		r.Get("/api/user/balance", handlers.GetBalanceHandler(balanceSrv))
 		r.Post("/api/user/orders", handlers.LoadNumberHandler(accrualSrv))
 		r.Get("/api/user/orders", handlers.GetOrdersHandler(accrualSrv))
 		r.Post("/api/user/balance/withdraw", handlers.WithdrawHandler(withdrawSrv))
 		r.Get("/api/user/withdrawals", handlers.GetWithdrawalsHandler(withdrawSrv))
+		r.Get("/api/user/statement", handlers.GetStatementHandler(statementSrv))
 	})
 
-	return r
+	return r, syncSrv
 }
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/yury-kuznetsov/gofermart/internal/migrations"
+	"strconv"
+)
+
+// migrate выполняет подкоманду `gophermart migrate up|down [N]|version`
+func migrate(ctx context.Context, m *migrations.Migrator, args []string) error {
+	command := "up"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	switch command {
+	case "up":
+		return m.Up(ctx)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			var err error
+			if steps, err = strconv.Atoi(args[1]); err != nil {
+				return fmt.Errorf("некорректное число шагов отката %q", args[1])
+			}
+		}
+		return m.Down(ctx, steps)
+	case "version":
+		version, err := m.Version(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("версия схемы: %d, ожидается: %d\n", version, m.Latest())
+		return nil
+	}
+
+	return fmt.Errorf("неизвестная команда %q, ожидается up, down [N] или version", command)
+}
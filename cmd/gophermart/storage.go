@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	balanceRepository "github.com/yury-kuznetsov/gofermart/internal/balance/repository"
+	balanceService "github.com/yury-kuznetsov/gofermart/internal/balance/service"
+	"github.com/yury-kuznetsov/gofermart/internal/migrations"
+	"github.com/yury-kuznetsov/gofermart/internal/transaction"
+	userRepository "github.com/yury-kuznetsov/gofermart/internal/user/repository"
+	userService "github.com/yury-kuznetsov/gofermart/internal/user/service"
+	_ "modernc.org/sqlite"
+	"strings"
+)
+
+// sqlitePrefix отличает путь к файлу SQLite от адреса PostgreSQL
+const sqlitePrefix = "sqlite:"
+
+// repositories - хранилища, с которыми работают сервисы
+type repositories struct {
+	tx            *transaction.Manager
+	user          userService.UserRepository
+	refreshToken  userService.RefreshTokenRepository
+	revocation    userService.RevocationRepository
+	passwordReset userService.PasswordResetRepository
+	loginAttempt  userService.LoginAttemptRepository
+	resetRequest  userService.ResetRequestRepository
+	balance       balanceService.BalanceRepository
+	ledger        balanceService.LedgerRepository
+	accrual       balanceService.AccrualRepository
+	withdrawal    balanceService.WithdrawalsRepository
+	statement     balanceService.StatementRepository
+}
+
+// openDatabase подключается к PostgreSQL или, для адресов вида sqlite:<файл>, к встроенной SQLite
+func openDatabase(addr string) (*sql.DB, func(db *sql.DB) repositories, error) {
+	if path, ok := strings.CutPrefix(addr, sqlitePrefix); ok {
+		db, err := sql.Open("sqlite", path+"?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)")
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// SQLite допускает одного писателя, а база в памяти (sqlite::memory:)
+		// существует только в рамках соединения, поэтому соединение одно
+		db.SetMaxOpenConns(1)
+
+		return db, sqliteRepositories, nil
+	}
+
+	db, err := sql.Open("pgx", addr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return db, postgresRepositories, nil
+}
+
+func postgresRepositories(db *sql.DB) repositories {
+	return repositories{
+		tx:            transaction.NewManager(db),
+		user:          userRepository.NewUserRepository(db),
+		refreshToken:  userRepository.NewRefreshTokenRepository(db),
+		revocation:    userRepository.NewRevocationRepository(db),
+		passwordReset: userRepository.NewPasswordResetRepository(db),
+		loginAttempt:  userRepository.NewLoginAttemptRepository(db),
+		resetRequest:  userRepository.NewLoginAttemptRepository(db),
+		balance:       balanceRepository.NewBalanceRepository(db),
+		ledger:        balanceRepository.NewLedgerRepository(db),
+		accrual:       balanceRepository.NewAccrualRepository(db),
+		withdrawal:    balanceRepository.NewWithdrawalRepository(db),
+		statement:     balanceRepository.NewStatementRepository(db),
+	}
+}
+
+// sqliteRepositories хранит данные в файле SQLite, для работы на одном сервере без PostgreSQL
+func sqliteRepositories(db *sql.DB) repositories {
+	repos := postgresRepositories(db)
+	repos.accrual = balanceRepository.NewSQLiteAccrualRepository(db)
+
+	return repos
+}
+
+// memoryRepositories хранит данные во встроенной SQLite в памяти процесса, они теряются при остановке.
+// Схема создаётся при запуске, а транзакции откатываются так же, как в базе на диске.
+func memoryRepositories(ctx context.Context) (repositories, error) {
+	db, newRepositories, err := openDatabase(sqlitePrefix + ":memory:")
+	if err != nil {
+		return repositories{}, err
+	}
+
+	migrator, err := migrations.NewMigrator(db)
+	if err != nil {
+		return repositories{}, err
+	}
+	if err := migrator.Up(ctx); err != nil {
+		return repositories{}, err
+	}
+
+	return newRepositories(db), nil
+}
@@ -2,51 +2,138 @@ package mock
 
 import (
 	"context"
-	"errors"
 	"github.com/google/uuid"
 	"github.com/yury-kuznetsov/gofermart/internal/balance/model"
+	"github.com/yury-kuznetsov/gofermart/internal/storage"
+	"sort"
+	"sync"
+	"time"
 )
 
+type lease struct {
+	owner     string
+	expiresAt time.Time
+}
+
 type AccrualRepo struct {
+	mu       sync.RWMutex
 	accruals []model.Accrual
+	leases   map[uuid.UUID]lease
 }
 
 func (a *AccrualRepo) Save(_ context.Context, model model.Accrual) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	delete(a.leases, model.ID)
 	for i, accrual := range a.accruals {
 		if accrual.ID == model.ID {
 			a.accruals[i] = model
 			return nil
 		}
+		if accrual.Number == model.Number {
+			return storage.ErrDuplicate
+		}
 	}
 	a.accruals = append(a.accruals, model)
 	return nil
 }
 
+func (a *AccrualRepo) Create(_ context.Context, model model.Accrual) (model.Accrual, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, accrual := range a.accruals {
+		if accrual.Number == model.Number {
+			return accrual, nil
+		}
+	}
+	a.accruals = append(a.accruals, model)
+	return model, nil
+}
+
 func (a *AccrualRepo) FindByNumber(_ context.Context, number string) (model.Accrual, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
 	for _, accrual := range a.accruals {
 		if accrual.Number == number {
 			return accrual, nil
 		}
 	}
-	return model.Accrual{}, errors.New("accrual not found")
+	return model.Accrual{}, storage.ErrNotFound
 }
 
 func (a *AccrualRepo) FindByUser(_ context.Context, userID uuid.UUID) ([]model.Accrual, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
 	var accruals []model.Accrual
 	for _, accrual := range a.accruals {
 		if accrual.UserID == userID {
 			accruals = append(accruals, accrual)
 		}
 	}
+	sort.SliceStable(accruals, func(i, j int) bool {
+		return accruals[i].CreatedAt.Before(accruals[j].CreatedAt)
+	})
+	return accruals, nil
+}
+
+func (a *AccrualRepo) FindPage(
+	ctx context.Context,
+	userID uuid.UUID,
+	filter model.AccrualFilter,
+) ([]model.Accrual, error) {
+	// порядок такой же, как в БД: по времени загрузки, затем по идентификатору
+	all, _ := a.FindByUser(ctx, userID)
+	sort.Slice(all, func(i, j int) bool {
+		first, second := all[i], all[j]
+		if filter.Desc {
+			first, second = second, first
+		}
+		return model.NewCursor(second.CreatedAt, second.ID).Less(first.CreatedAt, first.ID)
+	})
+
+	var accruals []model.Accrual
+	for _, accrual := range all {
+		if len(accruals) == filter.Limit {
+			break
+		}
+		if filter.Match(accrual) {
+			accruals = append(accruals, accrual)
+		}
+	}
 	return accruals, nil
 }
 
-func (a *AccrualRepo) FindForSync(_ context.Context) ([]model.Accrual, error) {
+func (a *AccrualRepo) ClaimForSync(
+	_ context.Context,
+	owner string,
+	limit int,
+	duration time.Duration,
+) ([]model.Accrual, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.leases == nil {
+		a.leases = make(map[uuid.UUID]lease)
+	}
+
+	now := time.Now()
 	var accruals []model.Accrual
 	for _, accrual := range a.accruals {
-		if accrual.Status == model.StatusNew {
-			accruals = append(accruals, accrual)
+		if len(accruals) == limit {
+			break
+		}
+		if accrual.IsFinal() || accrual.NextCheckAt.After(now) {
+			continue
+		}
+		if l, ok := a.leases[accrual.ID]; ok && l.expiresAt.After(now) {
+			continue
 		}
+		a.leases[accrual.ID] = lease{owner: owner, expiresAt: now.Add(duration)}
+		accruals = append(accruals, accrual)
 	}
 	return accruals, nil
 }
@@ -2,16 +2,20 @@ package mock
 
 import (
 	"context"
-	"errors"
 	"github.com/google/uuid"
 	"github.com/yury-kuznetsov/gofermart/internal/balance/model"
+	"sync"
 )
 
 type BalanceRepo struct {
+	mu       sync.RWMutex
 	balances []model.Balance
 }
 
 func (b *BalanceRepo) Save(_ context.Context, model model.Balance) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
 	for i, balance := range b.balances {
 		if balance.UserID == model.UserID {
 			b.balances[i] = model
@@ -23,10 +27,15 @@ func (b *BalanceRepo) Save(_ context.Context, model model.Balance) error {
 }
 
 func (b *BalanceRepo) FindByUser(_ context.Context, userID uuid.UUID) (model.Balance, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
 	for _, balance := range b.balances {
 		if balance.UserID == userID {
 			return balance, nil
 		}
 	}
-	return model.Balance{}, errors.New("balance not found")
+
+	// как и в БД, у пользователя без движений нулевой баланс
+	return model.Balance{UserID: userID}, nil
 }
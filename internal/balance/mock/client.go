@@ -0,0 +1,40 @@
+package mock
+
+import (
+	"context"
+	"github.com/yury-kuznetsov/gofermart/internal/balance/model"
+	"sync"
+)
+
+// AccrualClient отвечает заранее заданными результатами вместо системы расчёта
+type AccrualClient struct {
+	Results map[string]model.AccrualResult
+	Errors  map[string]error
+
+	mu    sync.Mutex
+	calls int
+}
+
+func (c *AccrualClient) GetOrder(ctx context.Context, number string) (model.AccrualResult, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.calls++
+	if err := ctx.Err(); err != nil {
+		return model.AccrualResult{}, err
+	}
+	if err, ok := c.Errors[number]; ok {
+		return model.AccrualResult{}, err
+	}
+	if result, ok := c.Results[number]; ok {
+		return result, nil
+	}
+	return model.AccrualResult{Order: number, Status: model.AccrualRegistered}, nil
+}
+
+func (c *AccrualClient) Calls() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.calls
+}
@@ -0,0 +1,58 @@
+package mock
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/yury-kuznetsov/gofermart/internal/balance/model"
+	"github.com/yury-kuznetsov/gofermart/internal/storage"
+	"sync"
+)
+
+type LedgerRepo struct {
+	Balances *BalanceRepo
+	mu       sync.RWMutex
+	entries  []model.Entry
+}
+
+func (l *LedgerRepo) Post(ctx context.Context, entry model.Entry) error {
+	if !entry.IsBalanced() {
+		return errors.New("unbalanced entry")
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, e := range l.entries {
+		if e.Kind == entry.Kind && e.Reference == entry.Reference {
+			return storage.ErrDuplicate
+		}
+	}
+
+	// поддерживаем снимок баланса так же, как это делает БД
+	balance, _ := l.Balances.FindByUser(ctx, entry.UserID)
+	if entry.BalanceVersion != nil && *entry.BalanceVersion != balance.Version {
+		return storage.ErrConflict
+	}
+	balance.UserID = entry.UserID
+	balance.Version++
+	balance.Apply(entry)
+
+	entry.Seq = balance.Version
+	l.entries = append(l.entries, entry)
+
+	return l.Balances.Save(ctx, balance)
+}
+
+func (l *LedgerRepo) FindByUser(_ context.Context, userID uuid.UUID) ([]model.Entry, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	var entries []model.Entry
+	for _, entry := range l.entries {
+		if entry.UserID == userID {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
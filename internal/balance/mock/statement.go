@@ -0,0 +1,77 @@
+package mock
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/yury-kuznetsov/gofermart/internal/balance/model"
+	"sort"
+	"time"
+)
+
+// StatementRepo строит выписку по проводкам журнала на счёте пользователя
+type StatementRepo struct {
+	Ledger *LedgerRepo
+}
+
+func (s *StatementRepo) Balance(ctx context.Context, userID uuid.UUID, before time.Time) (model.Money, error) {
+	var balance model.Money
+	for _, line := range s.lines(ctx, userID) {
+		if line.Time.Before(before) {
+			balance += line.Amount
+		}
+	}
+	return balance, nil
+}
+
+func (s *StatementRepo) Lines(
+	ctx context.Context,
+	userID uuid.UUID,
+	period model.PageQuery,
+	after int64,
+	limit int,
+) ([]model.StatementLine, error) {
+	period = model.PageQuery{From: period.From, To: period.To}
+
+	var lines []model.StatementLine
+	for _, line := range s.lines(ctx, userID) {
+		if line.Seq <= after || !period.Contains(line.Time, line.ID) {
+			continue
+		}
+		if len(lines) == limit {
+			break
+		}
+		lines = append(lines, line)
+	}
+	return lines, nil
+}
+
+// lines возвращает операции по счёту в том же порядке, что и БД
+func (s *StatementRepo) lines(ctx context.Context, userID uuid.UUID) []model.StatementLine {
+	var lines []model.StatementLine
+
+	entries, _ := s.Ledger.FindByUser(ctx, userID)
+	for _, entry := range entries {
+		for _, posting := range entry.Postings {
+			if posting.Account != model.UserAccount(userID) {
+				continue
+			}
+			line := model.StatementLine{
+				ID:     entry.ID,
+				Seq:    entry.Seq,
+				Time:   entry.CreatedAt,
+				Kind:   entry.Kind,
+				Order:  entry.Reference,
+				Amount: posting.Amount,
+			}
+			if entry.Kind == model.EntryOpening {
+				line.Order = ""
+			}
+			lines = append(lines, line)
+		}
+	}
+
+	sort.Slice(lines, func(i, j int) bool {
+		return lines[i].Seq < lines[j].Seq
+	})
+	return lines
+}
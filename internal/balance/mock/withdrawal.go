@@ -4,23 +4,82 @@ import (
 	"context"
 	"github.com/google/uuid"
 	"github.com/yury-kuznetsov/gofermart/internal/balance/model"
+	"github.com/yury-kuznetsov/gofermart/internal/storage"
+	"sort"
+	"sync"
 )
 
 type WithdrawalRepo struct {
+	mu          sync.RWMutex
 	withdrawals []model.Withdrawal
 }
 
 func (w *WithdrawalRepo) Create(_ context.Context, withdrawal model.Withdrawal) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, existing := range w.withdrawals {
+		if existing.Number == withdrawal.Number {
+			return storage.ErrDuplicate
+		}
+	}
 	w.withdrawals = append(w.withdrawals, withdrawal)
 	return nil
 }
 
 func (w *WithdrawalRepo) FindByUser(_ context.Context, userID uuid.UUID) ([]model.Withdrawal, error) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
 	var withdrawals []model.Withdrawal
 	for _, withdrawal := range w.withdrawals {
 		if withdrawal.UserID == userID {
 			withdrawals = append(withdrawals, withdrawal)
 		}
 	}
+	sort.SliceStable(withdrawals, func(i, j int) bool {
+		return withdrawals[i].CreatedAt.Before(withdrawals[j].CreatedAt)
+	})
 	return withdrawals, nil
 }
+
+func (w *WithdrawalRepo) FindPage(
+	ctx context.Context,
+	userID uuid.UUID,
+	page model.PageQuery,
+) ([]model.Withdrawal, error) {
+	// порядок такой же, как в БД: по времени списания, затем по идентификатору
+	all, _ := w.FindByUser(ctx, userID)
+	sort.Slice(all, func(i, j int) bool {
+		first, second := all[i], all[j]
+		if page.Desc {
+			first, second = second, first
+		}
+		return model.NewCursor(second.CreatedAt, second.ID).Less(first.CreatedAt, first.ID)
+	})
+
+	var withdrawals []model.Withdrawal
+	for _, withdrawal := range all {
+		if len(withdrawals) == page.Limit {
+			break
+		}
+		if page.Contains(withdrawal.CreatedAt, withdrawal.ID) {
+			withdrawals = append(withdrawals, withdrawal)
+		}
+	}
+	return withdrawals, nil
+}
+
+func (w *WithdrawalRepo) Total(ctx context.Context, userID uuid.UUID, page model.PageQuery) (model.Money, error) {
+	all, _ := w.FindByUser(ctx, userID)
+
+	// учитывается только период
+	period := model.PageQuery{From: page.From, To: page.To}
+	var total model.Money
+	for _, withdrawal := range all {
+		if period.Contains(withdrawal.CreatedAt, withdrawal.ID) {
+			total += withdrawal.Sum
+		}
+	}
+	return total, nil
+}
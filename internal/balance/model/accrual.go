@@ -1,6 +1,7 @@
 package model
 
 import (
+	"encoding/json"
 	"github.com/google/uuid"
 	"time"
 )
@@ -12,11 +13,84 @@ const (
 	StatusProcessed  = "PROCESSED"
 )
 
+// статусы заказа в системе расчёта начислений
+const (
+	AccrualRegistered = "REGISTERED"
+	AccrualInvalid    = "INVALID"
+	AccrualProcessing = "PROCESSING"
+	AccrualProcessed  = "PROCESSED"
+)
+
+// AccrualResult - ответ системы расчёта начислений по заказу
+type AccrualResult struct {
+	Order   string `json:"order"`
+	Status  string `json:"status"`
+	Accrual *Money `json:"accrual,omitempty"`
+}
+
+// UnmarshalJSON округляет начисление до сотых: система расчёта может вернуть сумму с большим
+// числом знаков, и такой заказ иначе никогда не был бы зачислен
+func (r *AccrualResult) UnmarshalJSON(data []byte) error {
+	var result struct {
+		Order   string       `json:"order"`
+		Status  string       `json:"status"`
+		Accrual *json.Number `json:"accrual"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return err
+	}
+
+	*r = AccrualResult{Order: result.Order, Status: result.Status}
+	if result.Accrual != nil {
+		accrual, err := RoundMoney(result.Accrual.String())
+		if err != nil {
+			return err
+		}
+		r.Accrual = &accrual
+	}
+
+	return nil
+}
+
 type Accrual struct {
 	ID        uuid.UUID `json:"-"`
 	UserID    uuid.UUID `json:"-"`
 	Number    string    `json:"number"`
 	Status    string    `json:"status"`
-	Sum       *float64  `json:"accrual"`
+	Sum       *Money    `json:"accrual"`
 	CreatedAt time.Time `json:"uploaded_at"`
+
+	// состояние опроса системы расчёта начислений
+	Attempts    int       `json:"-"`
+	NextCheckAt time.Time `json:"-"`
+}
+
+// IsFinal сообщает, что статус заказа больше не изменится
+func (a Accrual) IsFinal() bool {
+	return a.Status == StatusProcessed || a.Status == StatusInvalid
+}
+
+// AccrualFilter - параметры выборки заказов пользователя
+type AccrualFilter struct {
+	PageQuery
+
+	// Statuses ограничивает статусы заказов, пустой список - любые
+	Statuses []string
+}
+
+// Match проверяет, попадает ли заказ в выборку без учёта ограничения размера страницы
+func (f AccrualFilter) Match(accrual Accrual) bool {
+	if !f.Contains(accrual.CreatedAt, accrual.ID) {
+		return false
+	}
+	if len(f.Statuses) == 0 {
+		return true
+	}
+	for _, status := range f.Statuses {
+		if accrual.Status == status {
+			return true
+		}
+	}
+
+	return false
 }
@@ -4,6 +4,7 @@ import "github.com/google/uuid"
 
 type Balance struct {
 	UserID     uuid.UUID `json:"-"`
-	Accrual    float64   `json:"current"`
-	Withdrawal float64   `json:"withdrawn"`
+	Accrual    Money     `json:"current"`
+	Withdrawal Money     `json:"withdrawn"`
+	Version    int64     `json:"-"`
 }
@@ -0,0 +1,98 @@
+package model
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// типы проводок журнала
+const (
+	EntryAccrual    = "ACCRUAL"
+	EntryWithdrawal = "WITHDRAWAL"
+
+	// EntryOpening переносит в журнал остаток, накопленный до его появления
+	EntryOpening = "OPENING"
+)
+
+// системные счета, с которыми корреспондируют счета пользователей
+const (
+	AccountAccrual    = "system:accrual"
+	AccountWithdrawal = "system:withdrawal"
+	AccountOpening    = "system:opening"
+)
+
+// Entry - неизменяемая запись журнала, сумма её проводок всегда равна нулю
+type Entry struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	Kind      string
+	Reference string
+	Postings  []Posting
+	CreatedAt time.Time
+
+	// Seq - порядковый номер записи среди записей пользователя, присваивается при проводке
+	Seq int64
+
+	// BalanceVersion - версия снимка баланса, по которой принималось решение о проводке.
+	// Проводка отклоняется, если снимок успел измениться; nil - без проверки.
+	BalanceVersion *int64
+}
+
+// Posting - движение по счёту: положительная сумма - дебет, отрицательная - кредит
+type Posting struct {
+	Account string
+	Amount  Money
+}
+
+// UserAccount возвращает код счёта баллов пользователя
+func UserAccount(userID uuid.UUID) string {
+	return "user:" + userID.String()
+}
+
+// NewAccrualEntry зачисляет баллы за заказ на счёт пользователя
+func NewAccrualEntry(userID uuid.UUID, number string, sum Money) Entry {
+	return newEntry(userID, EntryAccrual, number, AccountAccrual, UserAccount(userID), sum)
+}
+
+// NewWithdrawalEntry списывает баллы со счёта пользователя в счёт оплаты заказа
+func NewWithdrawalEntry(userID uuid.UUID, number string, sum Money) Entry {
+	return newEntry(userID, EntryWithdrawal, number, UserAccount(userID), AccountWithdrawal, sum)
+}
+
+func newEntry(userID uuid.UUID, kind, reference, from, to string, sum Money) Entry {
+	return Entry{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Kind:      kind,
+		Reference: reference,
+		Postings: []Posting{
+			{Account: from, Amount: -sum},
+			{Account: to, Amount: sum},
+		},
+		CreatedAt: time.Now(),
+	}
+}
+
+// IsBalanced проверяет, что дебет и кредит записи совпадают
+func (e Entry) IsBalanced() bool {
+	var total Money
+	for _, posting := range e.Postings {
+		total += posting.Amount
+	}
+
+	return len(e.Postings) > 1 && total == 0
+}
+
+// Apply учитывает запись журнала в сводном балансе пользователя
+func (b *Balance) Apply(entry Entry) {
+	for _, posting := range entry.Postings {
+		if posting.Account != UserAccount(b.UserID) {
+			continue
+		}
+		if entry.Kind == EntryWithdrawal {
+			b.Withdrawal -= posting.Amount
+		} else {
+			b.Accrual += posting.Amount
+		}
+	}
+}
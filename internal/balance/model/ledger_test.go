@@ -0,0 +1,32 @@
+package model
+
+import (
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestBalanceApply(t *testing.T) {
+	userID := uuid.New()
+	entries := []Entry{
+		NewAccrualEntry(userID, "12345678903", 100*Point),
+		NewAccrualEntry(userID, "9278923470", 50050),
+		NewWithdrawalEntry(userID, "79927398713", 42*Point),
+	}
+
+	balance := Balance{UserID: userID}
+	for _, entry := range entries {
+		assert.True(t, entry.IsBalanced())
+		balance.Apply(entry)
+	}
+
+	assert.Equal(t, Money(60050), balance.Accrual)
+	assert.Equal(t, 42*Point, balance.Withdrawal)
+}
+
+func TestBalanceApplyIgnoresOtherUsers(t *testing.T) {
+	balance := Balance{UserID: uuid.New()}
+	balance.Apply(NewAccrualEntry(uuid.New(), "12345678903", 100*Point))
+
+	assert.Equal(t, Money(0), balance.Accrual)
+}
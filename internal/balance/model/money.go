@@ -0,0 +1,129 @@
+package model
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Money хранит сумму баллов в сотых долях, чтобы избежать ошибок округления float64
+type Money int64
+
+// Point - один целый балл
+const Point Money = 100
+
+var ErrInvalidMoney = errors.New("некорректная сумма")
+
+// ParseMoney разбирает десятичную запись суммы, не допуская потери точности
+func ParseMoney(s string) (Money, error) {
+	cents, ok := parseRat(s)
+	if !ok || !cents.IsInt() || !cents.Num().IsInt64() {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidMoney, s)
+	}
+
+	return Money(cents.Num().Int64()), nil
+}
+
+// RoundMoney разбирает десятичную запись суммы и округляет её до сотых, половина - от нуля.
+// Нужна для сумм, которые считает не пользователь, например начислений в процентах от цены.
+func RoundMoney(s string) (Money, error) {
+	cents, ok := parseRat(s)
+	if !ok {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidMoney, s)
+	}
+
+	quo, rem := new(big.Int).QuoRem(cents.Num(), cents.Denom(), new(big.Int))
+	if rem.Abs(rem).Lsh(rem, 1).Cmp(cents.Denom()) >= 0 {
+		quo.Add(quo, big.NewInt(int64(cents.Sign())))
+	}
+	if !quo.IsInt64() {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidMoney, s)
+	}
+
+	return Money(quo.Int64()), nil
+}
+
+// parseRat разбирает десятичную запись суммы в сотых долях
+func parseRat(s string) (*big.Rat, bool) {
+	r, ok := new(big.Rat).SetString(strings.TrimSpace(s))
+	if !ok {
+		return nil, false
+	}
+
+	return r.Mul(r, big.NewRat(int64(Point), 1)), true
+}
+
+// String возвращает сумму в том же виде, в каком её кодирует encoding/json для float64
+func (m Money) String() string {
+	value := int64(m)
+	sign := ""
+	if value < 0 {
+		sign = "-"
+		value = -value
+	}
+
+	s := sign + strconv.FormatInt(value/int64(Point), 10)
+	if cents := value % int64(Point); cents != 0 {
+		s += "." + strings.TrimRight(fmt.Sprintf("%02d", cents), "0")
+	}
+
+	return s
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+func (m *Money) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+
+	value, err := ParseMoney(string(data))
+	if err != nil {
+		return err
+	}
+	*m = value
+
+	return nil
+}
+
+// Scan читает сумму в копейках. Колонки хранят bigint, но PostgreSQL возвращает sum() от них
+// как numeric, то есть строкой.
+func (m *Money) Scan(src any) error {
+	var err error
+	switch v := src.(type) {
+	case nil:
+		*m = 0
+	case int64:
+		*m = Money(v)
+	case float64:
+		*m = Money(math.Round(v))
+	case string:
+		*m, err = parseCents(v)
+	case []byte:
+		*m, err = parseCents(string(v))
+	default:
+		err = fmt.Errorf("%w: неподдерживаемый тип %T", ErrInvalidMoney, src)
+	}
+
+	return err
+}
+
+func parseCents(s string) (Money, error) {
+	value, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidMoney, s)
+	}
+
+	return Money(value), nil
+}
+
+// Value сохраняет сумму целым числом копеек
+func (m Money) Value() (driver.Value, error) {
+	return int64(m), nil
+}
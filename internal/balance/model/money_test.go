@@ -0,0 +1,106 @@
+package model
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    Money
+		wantErr bool
+	}{
+		{input: "500", want: 500 * Point},
+		{input: "500.5", want: 50050},
+		{input: "0.05", want: 5},
+		{input: "-42.10", want: -4210},
+		{input: "5e2", want: 500 * Point},
+		{input: "0.001", wantErr: true},
+		{input: "abc", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseMoney(tt.input)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidMoney)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestRoundMoney(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    Money
+		wantErr bool
+	}{
+		{input: "500.5", want: 50050},
+		{input: "12.345", want: 1235},
+		{input: "12.344", want: 1234},
+		{input: "-12.345", want: -1235},
+		{input: "0.004", want: 0},
+		{input: "1e-3", want: 0},
+		{input: "abc", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := RoundMoney(tt.input)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidMoney)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestMoneyJSONMatchesFloat(t *testing.T) {
+	// формат ответа должен совпадать с тем, что отдавался при float64
+	for _, value := range []float64{0, 42, 500.5, 0.05, 729.98, -3.1} {
+		expected, _ := json.Marshal(value)
+
+		money, err := ParseMoney(string(expected))
+		assert.NoError(t, err)
+
+		actual, err := json.Marshal(money)
+		assert.NoError(t, err)
+		assert.Equal(t, string(expected), string(actual))
+	}
+}
+
+func TestMoneyScan(t *testing.T) {
+	tests := []struct {
+		name string
+		src  any
+		want Money
+	}{
+		{name: "Nil", src: nil, want: 0},
+		{name: "Int", src: int64(72998), want: 72998},
+		{name: "Numeric", src: []byte("10020"), want: 10020},
+		{name: "NumericString", src: "-150", want: -150},
+		{name: "Float", src: 29.999999999999996, want: 30},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var m Money
+			assert.NoError(t, m.Scan(tt.src))
+			assert.Equal(t, tt.want, m)
+		})
+	}
+
+	// в колонке копейки, дробная запись означает ошибку схемы
+	var m Money
+	assert.ErrorIs(t, m.Scan("100.20"), ErrInvalidMoney)
+}
+
+func TestMoneyValue(t *testing.T) {
+	value, err := Money(72998).Value()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(72998), value)
+}
@@ -0,0 +1,87 @@
+package model
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/google/uuid"
+	"time"
+)
+
+// ограничения размера страницы при постраничной выдаче
+const (
+	DefaultPageLimit = 100
+	MaxPageLimit     = 1000
+)
+
+var ErrInvalidCursor = errors.New("некорректный курсор")
+
+// Cursor - позиция в выборке, упорядоченной по времени создания и идентификатору.
+// Следующая страница начинается сразу после записи, на которую указывает курсор.
+type Cursor struct {
+	CreatedAt time.Time `json:"t"`
+	ID        uuid.UUID `json:"id"`
+}
+
+// PageQuery - общие параметры постраничной выдачи
+type PageQuery struct {
+	// From и To ограничивают время создания записей: From <= t < To, нулевое значение - без границы
+	From time.Time
+	To   time.Time
+
+	Desc  bool
+	After *Cursor
+	Limit int
+}
+
+// NewCursor указывает на запись, которой закончилась страница
+func NewCursor(createdAt time.Time, id uuid.UUID) *Cursor {
+	return &Cursor{CreatedAt: createdAt, ID: id}
+}
+
+// String кодирует курсор для передачи клиенту, клиент не должен разбирать его содержимое
+func (c Cursor) String() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func ParseCursor(s string) (Cursor, error) {
+	var c Cursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(data, &c); err != nil || c.ID == uuid.Nil {
+		return c, ErrInvalidCursor
+	}
+
+	return c, nil
+}
+
+// Less сообщает, идёт ли запись (createdAt, id) раньше курсора в порядке возрастания
+func (c Cursor) Less(createdAt time.Time, id uuid.UUID) bool {
+	if !createdAt.Equal(c.CreatedAt) {
+		return createdAt.Before(c.CreatedAt)
+	}
+
+	return id.String() < c.ID.String()
+}
+
+// Contains проверяет, попадает ли запись в выборку без учёта ограничения размера страницы
+func (q PageQuery) Contains(createdAt time.Time, id uuid.UUID) bool {
+	if !q.From.IsZero() && createdAt.Before(q.From) {
+		return false
+	}
+	if !q.To.IsZero() && !createdAt.Before(q.To) {
+		return false
+	}
+	if q.After == nil {
+		return true
+	}
+	if createdAt.Equal(q.After.CreatedAt) && id == q.After.ID {
+		return false
+	}
+
+	// после курсора в выбранном направлении
+	return q.After.Less(createdAt, id) == q.Desc
+}
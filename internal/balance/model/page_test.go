@@ -0,0 +1,52 @@
+package model
+
+import (
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestCursorString(t *testing.T) {
+	cursor := Cursor{CreatedAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), ID: uuid.New()}
+
+	parsed, err := ParseCursor(cursor.String())
+	assert.NoError(t, err)
+	assert.True(t, cursor.CreatedAt.Equal(parsed.CreatedAt))
+	assert.Equal(t, cursor.ID, parsed.ID)
+
+	for _, s := range []string{"", "not base64!", "e30"} {
+		_, err := ParseCursor(s)
+		assert.ErrorIs(t, err, ErrInvalidCursor, s)
+	}
+}
+
+func TestPageQueryContains(t *testing.T) {
+	now := time.Now()
+	id := uuid.MustParse("00000000-0000-0000-0000-000000000002")
+	smaller := uuid.MustParse("00000000-0000-0000-0000-000000000001")
+	cursor := NewCursor(now, id)
+
+	tests := []struct {
+		name      string
+		query     PageQuery
+		createdAt time.Time
+		id        uuid.UUID
+		want      bool
+	}{
+		{name: "NoLimits", query: PageQuery{}, createdAt: now, id: id, want: true},
+		{name: "BeforeFrom", query: PageQuery{From: now}, createdAt: now.Add(-time.Second), id: id, want: false},
+		{name: "AtFrom", query: PageQuery{From: now}, createdAt: now, id: id, want: true},
+		{name: "AtTo", query: PageQuery{To: now}, createdAt: now, id: id, want: false},
+		{name: "CursorItself", query: PageQuery{After: cursor}, createdAt: now, id: id, want: false},
+		{name: "AfterCursor", query: PageQuery{After: cursor}, createdAt: now.Add(time.Second), id: smaller, want: true},
+		{name: "SameTimeSmallerID", query: PageQuery{After: cursor}, createdAt: now, id: smaller, want: false},
+		{name: "DescSameTimeSmallerID", query: PageQuery{After: cursor, Desc: true}, createdAt: now, id: smaller, want: true},
+		{name: "DescLater", query: PageQuery{After: cursor, Desc: true}, createdAt: now.Add(time.Second), id: id, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.query.Contains(tt.createdAt, tt.id))
+		})
+	}
+}
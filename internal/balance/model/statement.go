@@ -0,0 +1,19 @@
+package model
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// StatementLine - строка выписки по счёту баллов пользователя
+type StatementLine struct {
+	ID     uuid.UUID `json:"-"`
+	Seq    int64     `json:"-"`
+	Time   time.Time `json:"time"`
+	Kind   string    `json:"type"`
+	Order  string    `json:"order"`
+	Amount Money     `json:"amount"`
+
+	// Balance - остаток после операции
+	Balance Money `json:"balance"`
+}
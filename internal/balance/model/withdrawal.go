@@ -9,6 +9,6 @@ type Withdrawal struct {
 	ID        uuid.UUID `json:"-"`
 	UserID    uuid.UUID `json:"-"`
 	Number    string    `json:"order"`
-	Sum       float64   `json:"sum"`
+	Sum       Money     `json:"sum"`
 	CreatedAt time.Time `json:"processed_at"`
 }
@@ -5,37 +5,36 @@ import (
 	"database/sql"
 	"github.com/google/uuid"
 	"github.com/yury-kuznetsov/gofermart/internal/balance/model"
+	"github.com/yury-kuznetsov/gofermart/internal/storage"
+	"github.com/yury-kuznetsov/gofermart/internal/transaction"
+	"strings"
 	"time"
 )
 
+const accrualColumns = "id, user_id, number, status, sum, created_at, attempts, next_check_at"
+
 type AccrualRepository struct {
 	db *sql.DB
+
+	// блокировка строк, выбранных для аренды, чтобы экземпляры не ждали друг друга
+	lockClause string
 }
 
 func NewAccrualRepository(db *sql.DB) *AccrualRepository {
-	r := &AccrualRepository{db: db}
-
-	_, _ = r.db.Exec(`CREATE TABLE IF NOT EXISTS balance_accrual (
-		id         uuid    not null constraint orders_pk primary key,
-		user_id    uuid    not null constraint orders_users_id_fk references "user",
-		number     varchar not null constraint orders_pk_2 unique,
-		status     varchar not null,
-		sum    	   decimal,
-		created_at timestamp
-	)`)
-
-	return r
+	return &AccrualRepository{db: db, lockClause: "FOR UPDATE SKIP LOCKED"}
 }
 
 func (r *AccrualRepository) Save(ctx context.Context, model model.Accrual) error {
-	queryUpdate := "UPDATE balance_accrual SET status = $1, sum = $2 WHERE id = $3"
-	queryInsert := "INSERT INTO balance_accrual VALUES ($1, $2, $3, $4, $5, $6)"
+	queryUpdate := `UPDATE balance_accrual
+		SET status = $1, sum = $2, attempts = $3, next_check_at = $4, lease_owner = NULL, lease_expires_at = NULL
+		WHERE id = $5`
+	queryInsert := "INSERT INTO balance_accrual (" + accrualColumns + ") VALUES ($1, $2, $3, $4, $5, $6, $7, $8)"
 
 	// обновляем запись
-	result, err := r.db.ExecContext(
+	result, err := transaction.Conn(ctx, r.db).ExecContext(
 		ctx,
 		queryUpdate,
-		model.Status, model.Sum, model.ID,
+		model.Status, model.Sum, model.Attempts, model.NextCheckAt.Format(time.RFC3339), model.ID,
 	)
 	if err != nil {
 		return err
@@ -48,30 +47,78 @@ func (r *AccrualRepository) Save(ctx context.Context, model model.Accrual) error
 	}
 
 	// добавляем запись
-	_, err = r.db.ExecContext(
+	_, err = transaction.Conn(ctx, r.db).ExecContext(
 		ctx,
 		queryInsert,
-		model.ID, model.UserID, model.Number, model.Status, model.Sum, model.CreatedAt.Format(time.RFC3339),
+		model.ID,
+		model.UserID,
+		model.Number,
+		model.Status,
+		model.Sum,
+		model.CreatedAt.Format(time.RFC3339),
+		model.Attempts,
+		model.NextCheckAt.Format(time.RFC3339),
+	)
+
+	return storage.Translate(err)
+}
+
+// Create добавляет заказ и возвращает сохранённую запись. Если заказ с таким номером
+// уже загружен, в том числе параллельным запросом, возвращается существующая запись.
+func (r *AccrualRepository) Create(ctx context.Context, accrual model.Accrual) (model.Accrual, error) {
+	// обновление без изменений нужно, чтобы RETURNING вернул существующую запись
+	rows, err := transaction.Conn(ctx, r.db).QueryContext(
+		ctx,
+		"INSERT INTO balance_accrual ("+accrualColumns+") VALUES ($1, $2, $3, $4, $5, $6, $7, $8)"+
+			" ON CONFLICT (number) DO UPDATE SET number = excluded.number RETURNING "+accrualColumns,
+		accrual.ID,
+		accrual.UserID,
+		accrual.Number,
+		accrual.Status,
+		accrual.Sum,
+		accrual.CreatedAt.Format(time.RFC3339),
+		accrual.Attempts,
+		accrual.NextCheckAt.Format(time.RFC3339),
 	)
+	if err != nil {
+		return model.Accrual{}, storage.Translate(err)
+	}
 
-	return err
+	accruals, err := parseRows(rows)
+	if err != nil {
+		return model.Accrual{}, err
+	}
+	if len(accruals) == 0 {
+		return model.Accrual{}, storage.ErrNotFound
+	}
+
+	return accruals[0], nil
 }
 
 func (r *AccrualRepository) FindByNumber(ctx context.Context, number string) (model.Accrual, error) {
 	var accrual model.Accrual
-	err := r.db.QueryRowContext(
+	err := transaction.Conn(ctx, r.db).QueryRowContext(
 		ctx,
-		"SELECT * FROM balance_accrual WHERE number = $1",
+		"SELECT "+accrualColumns+" FROM balance_accrual WHERE number = $1",
 		number,
-	).Scan(&accrual.ID, &accrual.UserID, &accrual.Number, &accrual.Status, &accrual.Sum, &accrual.CreatedAt)
+	).Scan(
+		&accrual.ID,
+		&accrual.UserID,
+		&accrual.Number,
+		&accrual.Status,
+		&accrual.Sum,
+		&accrual.CreatedAt,
+		&accrual.Attempts,
+		&accrual.NextCheckAt,
+	)
 
-	return accrual, err
+	return accrual, storage.Translate(err)
 }
 
 func (r *AccrualRepository) FindByUser(ctx context.Context, userID uuid.UUID) ([]model.Accrual, error) {
-	rows, err := r.db.QueryContext(
+	rows, err := transaction.Conn(ctx, r.db).QueryContext(
 		ctx,
-		"SELECT * FROM balance_accrual WHERE user_id = $1 ORDER BY created_at",
+		"SELECT "+accrualColumns+" FROM balance_accrual WHERE user_id = $1 ORDER BY created_at",
 		userID,
 	)
 	if err != nil {
@@ -81,11 +128,65 @@ func (r *AccrualRepository) FindByUser(ctx context.Context, userID uuid.UUID) ([
 	return parseRows(rows)
 }
 
-func (r *AccrualRepository) FindForSync(ctx context.Context) ([]model.Accrual, error) {
-	rows, err := r.db.QueryContext(
+// FindPage возвращает страницу заказов пользователя, отобранных по фильтру
+func (r *AccrualRepository) FindPage(
+	ctx context.Context,
+	userID uuid.UUID,
+	filter model.AccrualFilter,
+) ([]model.Accrual, error) {
+	var where conditions
+	where.add("user_id = ?", userID)
+	if len(filter.Statuses) > 0 {
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(filter.Statuses)), ", ")
+		statuses := make([]any, len(filter.Statuses))
+		for i, status := range filter.Statuses {
+			statuses[i] = status
+		}
+		where.add("status IN ("+placeholders+")", statuses...)
+	}
+	where.page(filter.PageQuery)
+
+	rows, err := transaction.Conn(ctx, r.db).QueryContext(
 		ctx,
-		"SELECT * FROM balance_accrual WHERE status = $1",
+		"SELECT "+accrualColumns+" FROM balance_accrual WHERE "+where.String()+orderAndLimit(filter.PageQuery),
+		where.args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseRows(rows)
+}
+
+// ClaimForSync арендует заказы в незавершённых статусах, которые пора проверить.
+// Заказы, арендованные другими экземплярами, пропускаются до истечения аренды,
+// поэтому упавший экземпляр не блокирует их навсегда. Аренда снимается при Save.
+func (r *AccrualRepository) ClaimForSync(
+	ctx context.Context,
+	owner string,
+	limit int,
+	lease time.Duration,
+) ([]model.Accrual, error) {
+	now := time.Now()
+	rows, err := transaction.Conn(ctx, r.db).QueryContext(
+		ctx,
+		`UPDATE balance_accrual SET lease_owner = $1, lease_expires_at = $2
+		WHERE id IN (
+			SELECT id FROM balance_accrual
+			WHERE status IN ($3, $4)
+				AND next_check_at <= $5
+				AND (lease_expires_at IS NULL OR lease_expires_at <= $5)
+			ORDER BY next_check_at
+			LIMIT $6
+			`+r.lockClause+`
+		)
+		RETURNING `+accrualColumns,
+		owner,
+		now.Add(lease).Format(time.RFC3339),
 		model.StatusNew,
+		model.StatusProcessing,
+		now.Format(time.RFC3339),
+		limit,
 	)
 	if err != nil {
 		return nil, err
@@ -105,6 +206,8 @@ func parseRows(rows *sql.Rows) ([]model.Accrual, error) {
 			&accrual.Status,
 			&accrual.Sum,
 			&accrual.CreatedAt,
+			&accrual.Attempts,
+			&accrual.NextCheckAt,
 		)
 		if err != nil {
 			return nil, err
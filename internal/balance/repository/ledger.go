@@ -0,0 +1,156 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/yury-kuznetsov/gofermart/internal/balance/model"
+	"github.com/yury-kuznetsov/gofermart/internal/storage"
+	"github.com/yury-kuznetsov/gofermart/internal/transaction"
+	"time"
+)
+
+var ErrUnbalancedEntry = errors.New("сумма проводок записи журнала не равна нулю")
+
+type LedgerRepository struct {
+	db *sql.DB
+}
+
+func NewLedgerRepository(db *sql.DB) *LedgerRepository {
+	return &LedgerRepository{db: db}
+}
+
+// Post добавляет запись в журнал и обновляет сводный баланс пользователя
+func (r *LedgerRepository) Post(ctx context.Context, entry model.Entry) error {
+	if !entry.IsBalanced() {
+		return ErrUnbalancedEntry
+	}
+
+	// запись и снимок меняются атомарно, в том числе внутри внешней транзакции
+	return transaction.NewManager(r.db).WithinTx(ctx, func(ctx context.Context) error {
+		return r.post(ctx, transaction.Conn(ctx, r.db), entry)
+	})
+}
+
+func (r *LedgerRepository) post(ctx context.Context, tx transaction.Executor, entry model.Entry) error {
+	// заводим счета, которые встречаются впервые
+	for _, posting := range entry.Postings {
+		var userID *uuid.UUID
+		if posting.Account == model.UserAccount(entry.UserID) {
+			userID = &entry.UserID
+		}
+		_, err := tx.ExecContext(
+			ctx,
+			"INSERT INTO ledger_account (code, user_id, created_at) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING",
+			posting.Account, userID, entry.CreatedAt.Format(time.RFC3339),
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	// сохраняем запись журнала, не прерывая транзакцию при повторе
+	result, err := tx.ExecContext(
+		ctx,
+		`INSERT INTO ledger_entry (id, user_id, kind, reference, created_at) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (kind, reference) DO NOTHING`,
+		entry.ID, entry.UserID, entry.Kind, entry.Reference, entry.CreatedAt.Format(time.RFC3339),
+	)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return storage.ErrDuplicate
+	}
+
+	// сохраняем проводки записи
+	for _, posting := range entry.Postings {
+		_, err = tx.ExecContext(
+			ctx,
+			"INSERT INTO ledger_posting (entry_id, account, amount) VALUES ($1, $2, $3)",
+			entry.ID, posting.Account, posting.Amount,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	// обновляем сводный баланс, который служит снимком журнала
+	delta := model.Balance{UserID: entry.UserID}
+	delta.Apply(entry)
+	query := `INSERT INTO balance (user_id, accrual, withdrawal, version) VALUES ($1, $2, $3, 1)
+		ON CONFLICT (user_id) DO UPDATE
+		SET accrual = balance.accrual + excluded.accrual,
+			withdrawal = balance.withdrawal + excluded.withdrawal,
+			version = balance.version + 1`
+	args := []any{delta.UserID, delta.Accrual, delta.Withdrawal}
+	if entry.BalanceVersion != nil {
+		query += " WHERE balance.version = $4"
+		args = append(args, *entry.BalanceVersion)
+	}
+	var version int64
+	err = tx.QueryRowContext(ctx, query+" RETURNING version", args...).Scan(&version)
+
+	// снимок успел измениться после чтения
+	if errors.Is(err, sql.ErrNoRows) {
+		return storage.ErrConflict
+	}
+	if err != nil {
+		return err
+	}
+
+	// номер записи - версия снимка после проводки, строка снимка заблокирована до конца транзакции
+	_, err = tx.ExecContext(ctx, "UPDATE ledger_entry SET seq = $1 WHERE id = $2", version, entry.ID)
+
+	return err
+}
+
+// FindByUser возвращает историю движений по счёту пользователя в порядке проводки
+func (r *LedgerRepository) FindByUser(ctx context.Context, userID uuid.UUID) ([]model.Entry, error) {
+	rows, err := transaction.Conn(ctx, r.db).QueryContext(
+		ctx,
+		`SELECT e.id, e.user_id, e.kind, e.reference, e.created_at, e.seq, p.account, p.amount
+		FROM ledger_entry e JOIN ledger_posting p ON p.entry_id = e.id
+		WHERE e.user_id = $1
+		ORDER BY e.seq`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []model.Entry
+	for rows.Next() {
+		var entry model.Entry
+		var posting model.Posting
+		err := rows.Scan(
+			&entry.ID,
+			&entry.UserID,
+			&entry.Kind,
+			&entry.Reference,
+			&entry.CreatedAt,
+			&entry.Seq,
+			&posting.Account,
+			&posting.Amount,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		// строки одной записи идут подряд
+		if n := len(entries); n > 0 && entries[n-1].ID == entry.ID {
+			entries[n-1].Postings = append(entries[n-1].Postings, posting)
+			continue
+		}
+		entry.Postings = []model.Posting{posting}
+		entries = append(entries, entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"fmt"
+	"github.com/yury-kuznetsov/gofermart/internal/balance/model"
+	"strings"
+	"time"
+)
+
+// conditions собирает условие WHERE, нумеруя параметры по порядку добавления
+type conditions struct {
+	where []string
+	args  []any
+}
+
+// add добавляет условие, в котором параметры обозначены знаком ?
+func (c *conditions) add(condition string, args ...any) {
+	for _, arg := range args {
+		c.args = append(c.args, arg)
+		condition = strings.Replace(condition, "?", fmt.Sprintf("$%d", len(c.args)), 1)
+	}
+	c.where = append(c.where, condition)
+}
+
+// page добавляет границы периода и позицию курсора по полям created_at и id
+func (c *conditions) page(page model.PageQuery) {
+	c.period(page)
+	if page.After != nil {
+		op := ">"
+		if page.Desc {
+			op = "<"
+		}
+		createdAt := page.After.CreatedAt.Format(time.RFC3339)
+		c.add(
+			"(created_at "+op+" ? OR (created_at = ? AND id "+op+" ?))",
+			createdAt, createdAt, page.After.ID,
+		)
+	}
+}
+
+// period добавляет только границы периода по полю created_at
+func (c *conditions) period(page model.PageQuery) {
+	if !page.From.IsZero() {
+		c.add("created_at >= ?", page.From.Format(time.RFC3339))
+	}
+	if !page.To.IsZero() {
+		c.add("created_at < ?", page.To.Format(time.RFC3339))
+	}
+}
+
+func (c *conditions) String() string {
+	return strings.Join(c.where, " AND ")
+}
+
+// clause возвращает WHERE с условиями или пустую строку, если условий нет
+func (c *conditions) clause() string {
+	if len(c.where) == 0 {
+		return ""
+	}
+
+	return " WHERE " + c.String()
+}
+
+// orderAndLimit упорядочивает выборку в направлении страницы и ограничивает её размер
+func orderAndLimit(page model.PageQuery) string {
+	direction := "ASC"
+	if page.Desc {
+		direction = "DESC"
+	}
+
+	return fmt.Sprintf(" ORDER BY created_at %[1]s, id %[1]s LIMIT %d", direction, page.Limit)
+}
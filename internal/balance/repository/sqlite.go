@@ -0,0 +1,13 @@
+package repository
+
+import (
+	"database/sql"
+)
+
+// Запросы репозиториев переносимы между PostgreSQL и SQLite, кроме аренды заказов:
+// в SQLite нет блокировки строк, но запись в базу и так выполняет одно соединение.
+// Суммы в обеих базах хранятся целыми копейками (bigint), как model.Money.
+
+func NewSQLiteAccrualRepository(db *sql.DB) *AccrualRepository {
+	return &AccrualRepository{db: db}
+}
@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/yury-kuznetsov/gofermart/internal/balance/model"
+	"github.com/yury-kuznetsov/gofermart/internal/transaction"
+	"time"
+)
+
+// операции по счёту - проводки журнала по счёту пользователя: начисления со знаком плюс,
+// списания со знаком минус, с датой и порядковым номером проводки. У начального остатка нет номера заказа.
+const statementQuery = `SELECT id, seq, created_at, kind, number, amount FROM (
+		SELECT e.id, e.seq, e.created_at, e.kind,
+			CASE WHEN e.kind = '` + model.EntryOpening + `' THEN '' ELSE e.reference END AS number,
+			p.amount
+		FROM ledger_entry e JOIN ledger_posting p ON p.entry_id = e.id
+		WHERE e.user_id = $1 AND p.account = $2
+	) operations`
+
+type StatementRepository struct {
+	db *sql.DB
+}
+
+func NewStatementRepository(db *sql.DB) *StatementRepository {
+	return &StatementRepository{db: db}
+}
+
+// Balance возвращает остаток на счёте пользователя на момент before
+func (r *StatementRepository) Balance(ctx context.Context, userID uuid.UUID, before time.Time) (model.Money, error) {
+	var balance model.Money
+	err := transaction.Conn(ctx, r.db).QueryRowContext(
+		ctx,
+		"SELECT coalesce(sum(amount), 0) FROM ("+statementQuery+") statement WHERE created_at < $3",
+		userID, model.UserAccount(userID), before.Format(time.RFC3339),
+	).Scan(&balance)
+
+	return balance, err
+}
+
+// Lines возвращает не больше limit операций по счёту за период, проведённых после записи
+// с номером after, в порядке проводки. Время проводки хранится с точностью до секунды,
+// поэтому порядок задаёт номер записи. Остаток после операции (Balance) не заполняется.
+func (r *StatementRepository) Lines(
+	ctx context.Context,
+	userID uuid.UUID,
+	period model.PageQuery,
+	after int64,
+	limit int,
+) ([]model.StatementLine, error) {
+	where := conditions{args: []any{userID, model.UserAccount(userID)}}
+	where.period(period)
+	where.add("seq > ?", after)
+
+	rows, err := transaction.Conn(ctx, r.db).QueryContext(
+		ctx,
+		"SELECT * FROM ("+statementQuery+") statement"+where.clause()+fmt.Sprintf(" ORDER BY seq LIMIT %d", limit),
+		where.args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lines []model.StatementLine
+	for rows.Next() {
+		var line model.StatementLine
+		if err := rows.Scan(&line.ID, &line.Seq, &line.Time, &line.Kind, &line.Order, &line.Amount); err != nil {
+			return nil, err
+		}
+		lines = append(lines, line)
+	}
+
+	return lines, rows.Err()
+}
@@ -3,57 +3,86 @@ package repository
 import (
 	"context"
 	"database/sql"
-	"fmt"
 	"github.com/google/uuid"
 	"github.com/yury-kuznetsov/gofermart/internal/balance/model"
+	"github.com/yury-kuznetsov/gofermart/internal/storage"
+	"github.com/yury-kuznetsov/gofermart/internal/transaction"
 	"time"
 )
 
+const withdrawalColumns = "id, user_id, number, sum, created_at"
+
 type WithdrawalRepository struct {
 	db *sql.DB
 }
 
 func NewWithdrawalRepository(db *sql.DB) *WithdrawalRepository {
-	r := &WithdrawalRepository{db: db}
-
-	_, err := r.db.Exec(`CREATE TABLE IF NOT EXISTS balance_withdrawal (
-		id         uuid      not null constraint withdrawals_pk primary key,
-		user_id    uuid      not null constraint withdrawals_users_id_fk references "user",
-		number     varchar   not null constraint withdrawals_pk_2 unique,
-		sum        decimal   not null,
-		created_at timestamp
-	)`)
-
-	if err != nil {
-		fmt.Println(err.Error())
-	}
-
-	return r
+	return &WithdrawalRepository{db: db}
 }
 
 func (r *WithdrawalRepository) Create(ctx context.Context, model model.Withdrawal) error {
-	_, err := r.db.ExecContext(
+	_, err := transaction.Conn(ctx, r.db).ExecContext(
 		ctx,
-		`INSERT INTO balance_withdrawal VALUES ($1, $2, $3, $4, $5)`,
+		"INSERT INTO balance_withdrawal ("+withdrawalColumns+") VALUES ($1, $2, $3, $4, $5)",
 		model.ID, model.UserID, model.Number, model.Sum, model.CreatedAt.Format(time.RFC3339),
 	)
-	if err != nil {
-		return err
-	}
-	return nil
+
+	return storage.Translate(err)
 }
 
 func (r *WithdrawalRepository) FindByUser(ctx context.Context, userID uuid.UUID) ([]model.Withdrawal, error) {
-	var withdrawals []model.Withdrawal
-	rows, err := r.db.QueryContext(
+	rows, err := transaction.Conn(ctx, r.db).QueryContext(
 		ctx,
-		"SELECT * FROM balance_withdrawal WHERE user_id = $1 ORDER BY created_at",
+		"SELECT "+withdrawalColumns+" FROM balance_withdrawal WHERE user_id = $1 ORDER BY created_at",
 		userID,
 	)
 	if err != nil {
 		return nil, err
 	}
 
+	return parseWithdrawals(rows)
+}
+
+// FindPage возвращает страницу списаний пользователя за период
+func (r *WithdrawalRepository) FindPage(
+	ctx context.Context,
+	userID uuid.UUID,
+	page model.PageQuery,
+) ([]model.Withdrawal, error) {
+	var where conditions
+	where.add("user_id = ?", userID)
+	where.page(page)
+
+	rows, err := transaction.Conn(ctx, r.db).QueryContext(
+		ctx,
+		"SELECT "+withdrawalColumns+" FROM balance_withdrawal WHERE "+where.String()+orderAndLimit(page),
+		where.args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseWithdrawals(rows)
+}
+
+// Total возвращает сумму списаний пользователя за период, курсор и размер страницы не учитываются
+func (r *WithdrawalRepository) Total(ctx context.Context, userID uuid.UUID, page model.PageQuery) (model.Money, error) {
+	var where conditions
+	where.add("user_id = ?", userID)
+	where.period(page)
+
+	var total model.Money
+	err := transaction.Conn(ctx, r.db).QueryRowContext(
+		ctx,
+		"SELECT coalesce(sum(sum), 0) FROM balance_withdrawal WHERE "+where.String(),
+		where.args...,
+	).Scan(&total)
+
+	return total, err
+}
+
+func parseWithdrawals(rows *sql.Rows) ([]model.Withdrawal, error) {
+	var withdrawals []model.Withdrawal
 	for rows.Next() {
 		var withdrawal model.Withdrawal
 		err := rows.Scan(
@@ -69,7 +98,7 @@ func (r *WithdrawalRepository) FindByUser(ctx context.Context, userID uuid.UUID)
 		withdrawals = append(withdrawals, withdrawal)
 	}
 
-	if err = rows.Err(); err != nil {
+	if err := rows.Err(); err != nil {
 		return nil, err
 	}
 
@@ -4,7 +4,6 @@ import (
 	"context"
 	"errors"
 	"github.com/google/uuid"
-	"github.com/yury-kuznetsov/gofermart/cmd/gophermart/config"
 	"github.com/yury-kuznetsov/gofermart/internal/balance/model"
 	"github.com/yury-kuznetsov/gofermart/internal/validation"
 	"time"
@@ -16,19 +15,18 @@ var ErrAlreadyLoadedByAnotherUser = errors.New("номер заказа уже 
 
 type AccrualRepository interface {
 	Save(ctx context.Context, model model.Accrual) error
+	Create(ctx context.Context, model model.Accrual) (model.Accrual, error)
 	FindByNumber(ctx context.Context, number string) (model.Accrual, error)
 	FindByUser(ctx context.Context, userID uuid.UUID) ([]model.Accrual, error)
-	FindForSync(ctx context.Context) ([]model.Accrual, error)
+	FindPage(ctx context.Context, userID uuid.UUID, filter model.AccrualFilter) ([]model.Accrual, error)
+	ClaimForSync(ctx context.Context, owner string, limit int, lease time.Duration) ([]model.Accrual, error)
 }
 
 type AccrualService struct {
 	r AccrualRepository
 }
 
-func NewAccrualService(bRepo BalanceRepository, aRepo AccrualRepository) *AccrualService {
-	// запускаем сервис синхронизации
-	go NewSyncService(bRepo, aRepo, config.Options.AccrualAddr).Start()
-
+func NewAccrualService(aRepo AccrualRepository) *AccrualService {
 	return &AccrualService{r: aRepo}
 }
 
@@ -38,33 +36,51 @@ func (s *AccrualService) Load(ctx context.Context, userID uuid.UUID, number stri
 		return ErrIncorrectNumber
 	}
 
-	// проверяем наличие заказа с таким номером
-	accrual, _ := s.r.FindByNumber(ctx, number)
-	if accrual.ID != uuid.Nil {
-		if accrual.UserID == userID {
-			return ErrAlreadyLoadedByThisUser
-		}
-		return ErrAlreadyLoadedByAnotherUser
-	}
-
 	// добавляем номер заказа
-	accrual = model.Accrual{
-		ID:        uuid.New(),
-		UserID:    userID,
-		Number:    number,
-		Status:    model.StatusNew,
-		Sum:       nil,
-		CreatedAt: time.Now(),
+	now := time.Now()
+	accrual := model.Accrual{
+		ID:          uuid.New(),
+		UserID:      userID,
+		Number:      number,
+		Status:      model.StatusNew,
+		Sum:         nil,
+		CreatedAt:   now,
+		NextCheckAt: now,
 	}
-	err := s.r.Save(ctx, accrual)
 
-	if err != nil {
+	// уникальность номера обеспечивает хранилище, поэтому параллельные
+	// загрузки одного номера получают существующий заказ
+	stored, err := s.r.Create(ctx, accrual)
+	switch {
+	case err != nil:
 		return err
+	case stored.ID == accrual.ID:
+		return nil
+	case stored.UserID == userID:
+		return ErrAlreadyLoadedByThisUser
+	default:
+		return ErrAlreadyLoadedByAnotherUser
 	}
-
-	return nil
 }
 
 func (s *AccrualService) GetOrders(ctx context.Context, userID uuid.UUID) ([]model.Accrual, error) {
 	return s.r.FindByUser(ctx, userID)
 }
+
+// GetOrdersPage возвращает страницу заказов и курсор следующей страницы, если она есть
+func (s *AccrualService) GetOrdersPage(
+	ctx context.Context,
+	userID uuid.UUID,
+	filter model.AccrualFilter,
+) ([]model.Accrual, *model.Cursor, error) {
+	return fetchPage(
+		filter.Limit,
+		func(limit int) ([]model.Accrual, error) {
+			filter.Limit = limit
+			return s.r.FindPage(ctx, userID, filter)
+		},
+		func(order model.Accrual) (time.Time, uuid.UUID) {
+			return order.CreatedAt, order.ID
+		},
+	)
+}
@@ -2,10 +2,13 @@ package service
 
 import (
 	"context"
+	"errors"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/yury-kuznetsov/gofermart/internal/balance/mock"
 	"github.com/yury-kuznetsov/gofermart/internal/balance/model"
+	"strconv"
+	"sync"
 	"testing"
 	"time"
 )
@@ -63,6 +66,62 @@ func TestLoad(t *testing.T) {
 	}
 }
 
+// failingAccrualRepo имитирует недоступность базы данных
+type failingAccrualRepo struct {
+	mock.AccrualRepo
+}
+
+func (*failingAccrualRepo) Create(context.Context, model.Accrual) (model.Accrual, error) {
+	return model.Accrual{}, errors.New("connection refused")
+}
+
+func TestLoadRepositoryFailure(t *testing.T) {
+	srv := &AccrualService{r: &failingAccrualRepo{}}
+
+	// сбой хранилища не принимается за ранее загруженный заказ
+	err := srv.Load(context.Background(), uuid.New(), "12345678903")
+	assert.EqualError(t, err, "connection refused")
+}
+
+func TestLoadConcurrent(t *testing.T) {
+	srv := &AccrualService{r: &mock.AccrualRepo{}}
+	userID1 := uuid.New()
+	userID2 := uuid.New()
+
+	// один и тот же номер одновременно загружают два пользователя
+	var wg sync.WaitGroup
+	errs := make([]error, 10)
+	for i := range errs {
+		userID := userID1
+		if i%2 == 1 {
+			userID = userID2
+		}
+		wg.Add(1)
+		go func(i int, userID uuid.UUID) {
+			defer wg.Done()
+			errs[i] = srv.Load(context.Background(), userID, "12345678903")
+		}(i, userID)
+	}
+	wg.Wait()
+
+	// заказ принят ровно один раз: остальные запросы победителя получают повтор,
+	// а запросы второго пользователя - отказ
+	var accepted, sameUser, anotherUser int
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			accepted++
+		case errors.Is(err, ErrAlreadyLoadedByThisUser):
+			sameUser++
+		case errors.Is(err, ErrAlreadyLoadedByAnotherUser):
+			anotherUser++
+		}
+	}
+	assert.Equal(t, 1, accepted)
+	assert.Equal(t, 4, sameUser)
+	assert.Equal(t, 5, anotherUser)
+}
+
 func TestGetOrders(t *testing.T) {
 	accrual := model.Accrual{
 		ID:        uuid.New(),
@@ -81,3 +140,44 @@ func TestGetOrders(t *testing.T) {
 	assert.Len(t, accruals, 1)
 	assert.Equal(t, accruals[0].ID, accrual.ID)
 }
+
+func TestGetOrdersPage(t *testing.T) {
+	userID := uuid.New()
+	repo := &mock.AccrualRepo{}
+	start := time.Now().Add(-time.Hour)
+	for i := 0; i < 5; i++ {
+		_ = repo.Save(context.Background(), model.Accrual{
+			ID:        uuid.New(),
+			UserID:    userID,
+			Number:    strconv.Itoa(1000 + i),
+			Status:    model.StatusNew,
+			CreatedAt: start.Add(time.Duration(i) * time.Minute),
+		})
+	}
+	srv := &AccrualService{r: repo}
+
+	// проходим все страницы по курсору
+	var numbers []string
+	filter := model.AccrualFilter{PageQuery: model.PageQuery{Limit: 2}}
+	for pages := 0; ; pages++ {
+		orders, next, err := srv.GetOrdersPage(context.Background(), userID, filter)
+		assert.NoError(t, err)
+		for _, order := range orders {
+			numbers = append(numbers, order.Number)
+		}
+		if next == nil {
+			assert.Equal(t, 2, pages)
+			break
+		}
+		filter.After = next
+	}
+	assert.Equal(t, []string{"1000", "1001", "1002", "1003", "1004"}, numbers)
+
+	// последняя полная страница не ссылается на пустую
+	orders, next, err := srv.GetOrdersPage(context.Background(), userID, model.AccrualFilter{
+		PageQuery: model.PageQuery{Limit: 5},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, orders, 5)
+	assert.Nil(t, next)
+}
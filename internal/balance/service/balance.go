@@ -8,7 +8,10 @@ import (
 
 type BalanceRepository interface {
 	FindByUser(ctx context.Context, userID uuid.UUID) (model.Balance, error)
-	Save(ctx context.Context, balance model.Balance) error
+}
+
+type LedgerRepository interface {
+	Post(ctx context.Context, entry model.Entry) error
 }
 
 type BalanceService struct {
@@ -12,8 +12,8 @@ import (
 func TestGetBalance(t *testing.T) {
 	row := model.Balance{
 		UserID:     uuid.New(),
-		Accrual:    100,
-		Withdrawal: 20,
+		Accrual:    100 * model.Point,
+		Withdrawal: 20 * model.Point,
 	}
 
 	repo := &mock.BalanceRepo{}
@@ -0,0 +1,179 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/yury-kuznetsov/gofermart/internal/balance/model"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var ErrOrderNotRegistered = errors.New("заказ не зарегистрирован в системе расчёта")
+var ErrTooManyRequests = errors.New("превышено количество запросов к системе расчёта")
+var ErrAccrualUnavailable = errors.New("система расчёта начислений недоступна")
+
+// параметры HTTP-клиента системы расчёта по умолчанию
+const (
+	clientTimeout    = 5 * time.Second
+	clientRetries    = 3
+	clientRetryDelay = 100 * time.Millisecond
+	breakerThreshold = 5
+	breakerCooldown  = 30 * time.Second
+)
+
+// AccrualClient получает от системы расчёта состояние начисления по заказу
+type AccrualClient interface {
+	GetOrder(ctx context.Context, number string) (model.AccrualResult, error)
+}
+
+// errRetryLater означает, что запросы к системе расчёта нужно приостановить
+type errRetryLater struct {
+	err   error
+	after time.Duration
+}
+
+func (e *errRetryLater) Error() string {
+	return fmt.Sprintf("%v. Следующий запрос будет через %s.", e.err, e.after)
+}
+
+func (e *errRetryLater) Unwrap() error {
+	return e.err
+}
+
+// errServer - временная ошибка, после которой запрос имеет смысл повторить
+type errServer struct {
+	StatusCode int
+}
+
+func (e *errServer) Error() string {
+	return fmt.Sprintf("система расчёта ответила статусом %d", e.StatusCode)
+}
+
+type HTTPAccrualClient struct {
+	host       string
+	client     *http.Client
+	retries    int
+	retryDelay time.Duration
+	breaker    *circuitBreaker
+}
+
+func NewHTTPAccrualClient(host string) *HTTPAccrualClient {
+	return &HTTPAccrualClient{
+		host:       host,
+		client:     &http.Client{Timeout: clientTimeout},
+		retries:    clientRetries,
+		retryDelay: clientRetryDelay,
+		breaker:    &circuitBreaker{threshold: breakerThreshold, cooldown: breakerCooldown},
+	}
+}
+
+func (c *HTTPAccrualClient) GetOrder(ctx context.Context, number string) (model.AccrualResult, error) {
+	// система расчёта недавно была недоступна, не нагружаем её
+	if wait := c.breaker.Wait(); wait > 0 {
+		return model.AccrualResult{}, &errRetryLater{err: ErrAccrualUnavailable, after: wait}
+	}
+
+	for attempt := 0; ; attempt++ {
+		result, err := c.fetch(ctx, number)
+
+		// повторяем только сетевые ошибки и ошибки сервера
+		var e *errServer
+		var netErr net.Error
+		if err == nil || !(errors.As(err, &e) || errors.As(err, &netErr)) {
+			c.breaker.Success()
+			return result, err
+		}
+
+		if attempt == c.retries {
+			c.breaker.Failure()
+			return result, err
+		}
+
+		// экспоненциальная задержка со случайной составляющей
+		delay := c.retryDelay << attempt
+		delay = delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return result, ctx.Err()
+		}
+	}
+}
+
+func (c *HTTPAccrualClient) fetch(ctx context.Context, number string) (model.AccrualResult, error) {
+	var result model.AccrualResult
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.host+"/api/orders/"+number, nil)
+	if err != nil {
+		return result, err
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return result, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	// превышено количество запросов к сервису
+	case resp.StatusCode == http.StatusTooManyRequests:
+		retryAfter, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+		return result, &errRetryLater{err: ErrTooManyRequests, after: time.Duration(retryAfter) * time.Second}
+
+	// заказ не зарегистрирован в системе расчёта
+	case resp.StatusCode == http.StatusNoContent:
+		return result, ErrOrderNotRegistered
+
+	// внутренняя ошибка сервера
+	case resp.StatusCode >= http.StatusInternalServerError:
+		return result, &errServer{StatusCode: resp.StatusCode}
+
+	case resp.StatusCode != http.StatusOK:
+		return result, fmt.Errorf("неожиданный ответ системы расчёта: %d", resp.StatusCode)
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&result)
+
+	return result, err
+}
+
+// circuitBreaker перестаёт пропускать запросы после серии неудач на время cooldown
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openUntil time.Time
+}
+
+// Wait возвращает, сколько ещё ждать до следующей попытки
+func (b *circuitBreaker) Wait() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return time.Until(b.openUntil)
+}
+
+func (b *circuitBreaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+}
+
+func (b *circuitBreaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// после паузы достаточно одной неудачи, чтобы снова разомкнуть цепь
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openUntil = time.Now().Add(b.cooldown)
+	}
+}
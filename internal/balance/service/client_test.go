@@ -0,0 +1,116 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/yury-kuznetsov/gofermart/internal/balance/model"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestClient(handler http.HandlerFunc) (*HTTPAccrualClient, func()) {
+	server := httptest.NewServer(handler)
+	client := NewHTTPAccrualClient(server.URL)
+	client.retryDelay = time.Millisecond
+	return client, server.Close
+}
+
+func TestGetOrderRetriesServerErrors(t *testing.T) {
+	var calls atomic.Int32
+	client, stop := newTestClient(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write([]byte(`{"order":"12345678903","status":"PROCESSED","accrual":500.5}`))
+	})
+	defer stop()
+
+	result, err := client.GetOrder(context.Background(), "12345678903")
+	assert.NoError(t, err)
+	assert.Equal(t, int32(3), calls.Load())
+	assert.Equal(t, model.AccrualProcessed, result.Status)
+	assert.Equal(t, model.Money(50050), *result.Accrual)
+}
+
+func TestGetOrderRoundsAccrual(t *testing.T) {
+	// начисление в процентах от цены приходит с тремя знаками после запятой
+	client, stop := newTestClient(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"order":"12345678903","status":"PROCESSED","accrual":12.345}`))
+	})
+	defer stop()
+
+	result, err := client.GetOrder(context.Background(), "12345678903")
+	assert.NoError(t, err)
+	assert.Equal(t, model.AccrualProcessed, result.Status)
+	if assert.NotNil(t, result.Accrual) {
+		assert.Equal(t, model.Money(1235), *result.Accrual)
+	}
+}
+
+func TestGetOrderResponses(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		check   func(t *testing.T, err error)
+	}{
+		{
+			name: "TooManyRequests",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Retry-After", "60")
+				w.WriteHeader(http.StatusTooManyRequests)
+			},
+			check: func(t *testing.T, err error) {
+				var e *errRetryLater
+				assert.True(t, errors.As(err, &e))
+				assert.ErrorIs(t, err, ErrTooManyRequests)
+				assert.Equal(t, time.Minute, e.after)
+			},
+		},
+		{
+			name: "NotRegistered",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNoContent)
+			},
+			check: func(t *testing.T, err error) {
+				assert.ErrorIs(t, err, ErrOrderNotRegistered)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, stop := newTestClient(tt.handler)
+			defer stop()
+
+			_, err := client.GetOrder(context.Background(), "12345678903")
+			tt.check(t, err)
+		})
+	}
+}
+
+func TestGetOrderCircuitBreaker(t *testing.T) {
+	var calls atomic.Int32
+	client, stop := newTestClient(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	defer stop()
+
+	// каждая неудачная проверка заказа - это несколько попыток и одна неудача цепи
+	for i := 0; i < breakerThreshold; i++ {
+		_, err := client.GetOrder(context.Background(), "12345678903")
+		assert.Error(t, err)
+	}
+	assert.Equal(t, int32(breakerThreshold*(clientRetries+1)), calls.Load())
+
+	// цепь разомкнута: запрос не отправляется, обработчики должны подождать
+	_, err := client.GetOrder(context.Background(), "12345678903")
+	var e *errRetryLater
+	assert.True(t, errors.As(err, &e))
+	assert.ErrorIs(t, err, ErrAccrualUnavailable)
+	assert.Equal(t, int32(breakerThreshold*(clientRetries+1)), calls.Load())
+}
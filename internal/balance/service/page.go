@@ -0,0 +1,29 @@
+package service
+
+import (
+	"github.com/google/uuid"
+	"github.com/yury-kuznetsov/gofermart/internal/balance/model"
+	"time"
+)
+
+// fetchPage загружает страницу не больше limit записей и курсор следующей страницы, если она есть.
+// fetch получает размер выборки на одну запись больше, чтобы узнать о наличии следующей страницы,
+// position возвращает позицию записи для курсора.
+func fetchPage[T any](
+	limit int,
+	fetch func(limit int) ([]T, error),
+	position func(item T) (time.Time, uuid.UUID),
+) ([]T, *model.Cursor, error) {
+	if limit <= 0 || limit > model.MaxPageLimit {
+		limit = model.DefaultPageLimit
+	}
+
+	items, err := fetch(limit + 1)
+	if err != nil || len(items) <= limit {
+		return items, nil, err
+	}
+
+	items = items[:limit]
+
+	return items, model.NewCursor(position(items[limit-1])), nil
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/yury-kuznetsov/gofermart/internal/balance/model"
+	"testing"
+	"time"
+)
+
+func TestFetchPage(t *testing.T) {
+	start := time.Now()
+	ids := make([]uuid.UUID, 5)
+	for i := range ids {
+		ids[i] = uuid.New()
+	}
+
+	tests := []struct {
+		name      string
+		limit     int
+		available int
+		requested int
+		items     int
+		cursor    *model.Cursor
+	}{
+		{name: "DefaultLimit", limit: 0, available: 5, requested: model.DefaultPageLimit + 1, items: 5},
+		{name: "TooLargeLimit", limit: model.MaxPageLimit + 1, available: 5, requested: model.DefaultPageLimit + 1, items: 5},
+		{name: "ExactlyLimit", limit: 5, available: 5, requested: 6, items: 5},
+		{name: "NextPage", limit: 2, available: 5, requested: 3, items: 2, cursor: model.NewCursor(start.Add(time.Second), ids[1])},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requested int
+			items, next, err := fetchPage(
+				tt.limit,
+				func(limit int) ([]int, error) {
+					requested = limit
+					var items []int
+					for i := 0; i < min(limit, tt.available); i++ {
+						items = append(items, i)
+					}
+					return items, nil
+				},
+				func(item int) (time.Time, uuid.UUID) {
+					return start.Add(time.Duration(item) * time.Second), ids[item]
+				},
+			)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.requested, requested)
+			assert.Len(t, items, tt.items)
+			assert.Equal(t, tt.cursor, next)
+		})
+	}
+}
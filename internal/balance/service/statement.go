@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/yury-kuznetsov/gofermart/internal/balance/model"
+	"github.com/yury-kuznetsov/gofermart/internal/transaction"
+	"time"
+)
+
+// statementBatch - сколько операций выписки читается из хранилища за раз
+const statementBatch = 500
+
+type StatementRepository interface {
+	Balance(ctx context.Context, userID uuid.UUID, before time.Time) (model.Money, error)
+	Lines(ctx context.Context, userID uuid.UUID, period model.PageQuery, after int64, limit int) ([]model.StatementLine, error)
+}
+
+// StatementWriter получает выписку по частям, по мере чтения из хранилища
+type StatementWriter interface {
+	Begin(opening model.Money) error
+	Line(line model.StatementLine) error
+	End(closing model.Money) error
+}
+
+type StatementService struct {
+	tx transaction.ReadTxManager
+	r  StatementRepository
+}
+
+func NewStatementService(tx transaction.ReadTxManager, sRepo StatementRepository) *StatementService {
+	return &StatementService{tx: tx, r: sRepo}
+}
+
+// Write передаёт в w выписку за период: остаток на начало, операции с остатком после каждой
+// и остаток на конец. Нулевые границы периода означают всю историю счёта.
+// Операции читаются частями, а в w пишутся вне транзакции, чтобы медленный клиент не занимал базу.
+func (s *StatementService) Write(ctx context.Context, userID uuid.UUID, period model.PageQuery, w StatementWriter) error {
+	// остаток и первая часть операций читаются из одного снимка, иначе проводка между запросами
+	// нарушит сверку
+	var balance model.Money
+	var lines []model.StatementLine
+	err := s.tx.WithinReadTx(ctx, func(ctx context.Context) error {
+		var err error
+		if !period.From.IsZero() {
+			if balance, err = s.r.Balance(ctx, userID, period.From); err != nil {
+				return err
+			}
+		}
+		lines, err = s.r.Lines(ctx, userID, period, 0, statementBatch)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := w.Begin(balance); err != nil {
+		return err
+	}
+
+	// операции за период с нарастающим остатком. Номера записей растут в порядке проводки,
+	// поэтому следующая часть, прочитанная после последней переданной записи, продолжает
+	// предыдущую без пропусков и повторов, даже если между частями прошли новые проводки.
+	for {
+		for _, line := range lines {
+			balance += line.Amount
+			line.Balance = balance
+			if err := w.Line(line); err != nil {
+				return err
+			}
+		}
+		if len(lines) < statementBatch {
+			break
+		}
+
+		if lines, err = s.r.Lines(ctx, userID, period, lines[len(lines)-1].Seq, statementBatch); err != nil {
+			return err
+		}
+	}
+
+	return w.End(balance)
+}
@@ -0,0 +1,146 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/yury-kuznetsov/gofermart/internal/balance/mock"
+	"github.com/yury-kuznetsov/gofermart/internal/balance/model"
+	"testing"
+	"time"
+)
+
+// recordingWriter запоминает выписку, опционально прерывая её после первой строки
+type recordingWriter struct {
+	opening, closing model.Money
+	lines            []model.StatementLine
+	failOnLine       bool
+}
+
+func (r *recordingWriter) Begin(opening model.Money) error {
+	r.opening = opening
+	return nil
+}
+
+func (r *recordingWriter) Line(line model.StatementLine) error {
+	if r.failOnLine {
+		return errors.New("client disconnected")
+	}
+	r.lines = append(r.lines, line)
+	return nil
+}
+
+func (r *recordingWriter) End(closing model.Money) error {
+	r.closing = closing
+	return nil
+}
+
+// countingReadTx считает транзакции чтения, в которых строится выписка
+type countingReadTx struct {
+	calls int
+}
+
+func (c *countingReadTx) WithinReadTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	c.calls++
+	return fn(ctx)
+}
+
+func TestStatementWrite(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+	start := time.Now().Add(-time.Hour)
+	ledger := &mock.LedgerRepo{Balances: &mock.BalanceRepo{}}
+
+	// проводки журнала: начисление до периода, начисление и списание в периоде
+	for i, entry := range []model.Entry{
+		model.NewAccrualEntry(userID, luhnNumber(1000), 100*model.Point),
+		model.NewAccrualEntry(userID, luhnNumber(1001), 50*model.Point),
+		model.NewWithdrawalEntry(userID, luhnNumber(2000), 30*model.Point),
+	} {
+		entry.CreatedAt = start.Add(time.Duration(i*2) * time.Minute)
+		_ = ledger.Post(ctx, entry)
+	}
+
+	tx := &countingReadTx{}
+	srv := NewStatementService(tx, &mock.StatementRepo{Ledger: ledger})
+
+	// выписка за период после первого начисления
+	w := &recordingWriter{}
+	err := srv.Write(ctx, userID, model.PageQuery{From: start.Add(time.Minute)}, w)
+	assert.NoError(t, err)
+	assert.Equal(t, 100*model.Point, w.opening)
+	if assert.Len(t, w.lines, 2) {
+		assert.Equal(t, model.EntryAccrual, w.lines[0].Kind)
+		assert.Equal(t, 150*model.Point, w.lines[0].Balance)
+		assert.Equal(t, model.EntryWithdrawal, w.lines[1].Kind)
+		assert.Equal(t, -30*model.Point, w.lines[1].Amount)
+		assert.Equal(t, 120*model.Point, w.lines[1].Balance)
+	}
+	assert.Equal(t, 120*model.Point, w.closing)
+
+	// вся история начинается с нулевого остатка
+	w = &recordingWriter{}
+	assert.NoError(t, srv.Write(ctx, userID, model.PageQuery{}, w))
+	assert.Equal(t, model.Money(0), w.opening)
+	assert.Len(t, w.lines, 3)
+	assert.Equal(t, 120*model.Point, w.closing)
+
+	// ошибка записи прерывает выписку
+	w = &recordingWriter{failOnLine: true}
+	assert.Error(t, srv.Write(ctx, userID, model.PageQuery{}, w))
+	assert.Equal(t, model.Money(0), w.closing)
+
+	// каждая выписка читается в своей транзакции
+	assert.Equal(t, 3, tx.calls)
+}
+
+// activeReadTx отмечает, что выполняется транзакция чтения
+type activeReadTx struct {
+	active bool
+}
+
+func (a *activeReadTx) WithinReadTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	a.active = true
+	defer func() { a.active = false }()
+	return fn(ctx)
+}
+
+// outsideTxWriter запоминает, писалась ли выписка во время транзакции
+type outsideTxWriter struct {
+	recordingWriter
+	tx   *activeReadTx
+	inTx bool
+}
+
+func (o *outsideTxWriter) Begin(opening model.Money) error {
+	o.inTx = o.inTx || o.tx.active
+	return o.recordingWriter.Begin(opening)
+}
+
+func (o *outsideTxWriter) Line(line model.StatementLine) error {
+	o.inTx = o.inTx || o.tx.active
+	return o.recordingWriter.Line(line)
+}
+
+func TestStatementWriteBatches(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+	ledger := &mock.LedgerRepo{Balances: &mock.BalanceRepo{}}
+
+	// операций больше, чем читается за раз
+	for i := 0; i < statementBatch+1; i++ {
+		_ = ledger.Post(ctx, model.NewAccrualEntry(userID, luhnNumber(1000+i), model.Point))
+	}
+
+	tx := &activeReadTx{}
+	srv := NewStatementService(tx, &mock.StatementRepo{Ledger: ledger})
+
+	w := &outsideTxWriter{tx: tx}
+	assert.NoError(t, srv.Write(ctx, userID, model.PageQuery{}, w))
+	assert.Len(t, w.lines, statementBatch+1)
+	assert.Equal(t, model.Money(statementBatch+1)*model.Point, w.closing)
+
+	// клиенту пишут вне транзакции, чтобы медленный клиент не занимал базу
+	assert.False(t, w.inTx)
+}
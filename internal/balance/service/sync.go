@@ -2,140 +2,297 @@ package service
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
+	"expvar"
 	"fmt"
 	"github.com/google/uuid"
 	"github.com/yury-kuznetsov/gofermart/internal/balance/model"
-	"net/http"
-	"strconv"
+	"github.com/yury-kuznetsov/gofermart/internal/storage"
+	"github.com/yury-kuznetsov/gofermart/internal/transaction"
+	"os"
+	"sync"
 	"time"
 )
 
+// интервалы повторной проверки заказа, который ещё не получил итоговый статус
+const (
+	checkInterval    = 5 * time.Second
+	maxCheckInterval = 10 * time.Minute
+)
+
+// время, на которое экземпляр сервиса арендует заказы для обработки
+const leaseDuration = time.Minute
+
+// метрики синхронизации, публикуются через expvar (/debug/vars на служебном адресе)
+var (
+	syncQueueDepth = new(expvar.Int)
+	syncProcessed  = new(expvar.Int)
+	syncFailed     = new(expvar.Int)
+	syncThroughput = new(expvar.Float)
+)
+
+func init() {
+	metrics := expvar.NewMap("accrual_sync")
+	metrics.Set("queue_depth", syncQueueDepth)
+	metrics.Set("processed", syncProcessed)
+	metrics.Set("failed", syncFailed)
+	metrics.Set("throughput", syncThroughput)
+}
+
 type SyncService interface {
-	Start()
+	// Start берёт заказы в работу до отмены ctx и возвращает управление, когда обработчики
+	// завершат уже начатые заказы. Заказы обрабатываются в контексте orderCtx: его отмена
+	// прерывает и начатые заказы, например когда истекло время на остановку.
+	Start(ctx, orderCtx context.Context)
 }
 
-type errTooManyRequests struct {
-	RetryAfter int
+// rateLimiter приостанавливает все обработчики разом после ответа 429
+type rateLimiter struct {
+	mu    sync.Mutex
+	until time.Time
 }
 
-func (e *errTooManyRequests) Error() string {
-	return fmt.Sprintf("Следующий запрос будет через %d секунд.", e.RetryAfter)
+func (l *rateLimiter) PauseFor(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if until := time.Now().Add(d); until.After(l.until) {
+		l.until = until
+	}
+}
+
+func (l *rateLimiter) Wait(ctx context.Context) error {
+	l.mu.Lock()
+	d := time.Until(l.until)
+	l.mu.Unlock()
+
+	if d <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 type syncService struct {
-	bRepo BalanceRepository
-	aRepo AccrualRepository
-	host  string
+	tx      transaction.TxManager
+	lRepo   LedgerRepository
+	aRepo   AccrualRepository
+	client  AccrualClient
+	workers int
+	limiter *rateLimiter
+
+	// идентификатор экземпляра, от имени которого арендуются заказы
+	owner string
+
+	// данные для расчёта пропускной способности
+	lastProcessed int64
+	lastMeasure   time.Time
 }
 
 func NewSyncService(
-	bRepo BalanceRepository,
+	tx transaction.TxManager,
+	lRepo LedgerRepository,
 	aRepo AccrualRepository,
-	host string,
+	client AccrualClient,
+	workers int,
 ) SyncService {
+	if workers < 1 {
+		workers = 1
+	}
+
 	return &syncService{
-		bRepo: bRepo,
-		aRepo: aRepo,
-		host:  host,
+		tx:      tx,
+		lRepo:   lRepo,
+		aRepo:   aRepo,
+		client:  client,
+		workers: workers,
+		limiter: &rateLimiter{},
+		owner:   instanceName(),
 	}
 }
 
-func (s *syncService) Start() {
-	ticker := time.NewTicker(5 * time.Second)
+func (s *syncService) Start(ctx, orderCtx context.Context) {
+	// запускаем пул обработчиков
+	jobs := make(chan model.Accrual, s.workers)
+	var wg sync.WaitGroup
+	for i := 0; i < s.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.work(ctx, orderCtx, jobs)
+		}()
+	}
+
+	// при остановке дожидаемся обработчиков
+	defer func() {
+		close(jobs)
+		wg.Wait()
+	}()
+
+	s.lastMeasure = time.Now()
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
 
 	for {
-		<-ticker.C
-		orders, err := s.aRepo.FindForSync(context.Background())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// арендуем не больше, чем успеем обработать до окончания аренды
+		orders, err := s.aRepo.ClaimForSync(ctx, s.owner, s.workers*10, leaseDuration)
 		if err != nil {
 			fmt.Println(err)
 			continue
 		}
 
 		for _, order := range orders {
-			err := processOrder(s, order)
-			if err != nil {
-				fmt.Println(err)
-
-				// после 429 ошибки ждем какое-то время
-				var e *errTooManyRequests
-				if errors.As(err, &e) {
-					ticker.Stop()
-					time.Sleep(time.Duration(e.RetryAfter) * time.Second)
-					ticker = time.NewTicker(5 * time.Second)
-				}
+			select {
+			case <-ctx.Done():
+				return
+			case jobs <- order:
+				syncQueueDepth.Add(1)
 			}
 		}
+
+		s.measure()
 	}
 }
 
-func processOrder(s *syncService, order model.Accrual) error {
-	resp, err := http.Get(s.host + "/api/orders/" + order.Number)
-	if err != nil {
-		return err
+func (s *syncService) work(ctx, orderCtx context.Context, jobs <-chan model.Accrual) {
+	for order := range jobs {
+		syncQueueDepth.Add(-1)
+
+		// после остановки не берём новые заказы: их аренда истечёт,
+		// и они достанутся другому экземпляру или следующему запуску
+		if ctx.Err() != nil {
+			continue
+		}
+
+		// ждём, если система расчёта просила подождать
+		if err := s.limiter.Wait(ctx); err != nil {
+			continue
+		}
+
+		// начатый заказ доводим до конца и после остановки. Прервать его может только отмена
+		// orderCtx: незавершённая транзакция откатится, а заказ после окончания аренды
+		// будет обработан повторно.
+		err := processOrder(orderCtx, s, order)
+		if err != nil && orderCtx.Err() != nil {
+			continue
+		}
+		if err != nil {
+			syncFailed.Add(1)
+			fmt.Println(err)
+
+			// после 429 или при недоступности системы расчёта ждем всеми обработчиками
+			var e *errRetryLater
+			if errors.As(err, &e) {
+				s.limiter.PauseFor(e.after)
+			}
+			continue
+		}
+
+		syncProcessed.Add(1)
 	}
-	defer resp.Body.Close()
+}
+
+// instanceName возвращает уникальное имя экземпляра сервиса
+func instanceName() string {
+	host, _ := os.Hostname()
+	return host + "/" + uuid.NewString()
+}
 
-	// превышено количество запросов к сервису
-	if resp.StatusCode == http.StatusTooManyRequests {
-		retryAfter, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
-		return &errTooManyRequests{RetryAfter: retryAfter}
+// measure обновляет пропускную способность (заказов в секунду) с момента прошлого замера
+func (s *syncService) measure() {
+	now := time.Now()
+	processed := syncProcessed.Value()
+	if elapsed := now.Sub(s.lastMeasure).Seconds(); elapsed > 0 {
+		syncThroughput.Set(float64(processed-s.lastProcessed) / elapsed)
 	}
+	s.lastProcessed = processed
+	s.lastMeasure = now
+}
 
-	// заказ не зарегистрирован в системе расчёта
-	if resp.StatusCode == http.StatusNoContent {
-		order.Status = model.StatusInvalid
+func processOrder(ctx context.Context, s *syncService, order model.Accrual) error {
+	result, err := s.client.GetOrder(ctx, order.Number)
+
+	// система расчёта просит подождать или обработка прервана: заказ не трогаем, аренда истечёт сама
+	var e *errRetryLater
+	if errors.As(err, &e) || ctx.Err() != nil {
+		return err
 	}
 
-	// внутренняя ошибка сервера
-	if resp.StatusCode == http.StatusInternalServerError {
+	switch {
+	// заказ не зарегистрирован в системе расчёта
+	case errors.Is(err, ErrOrderNotRegistered):
 		order.Status = model.StatusInvalid
-	}
 
-	if resp.StatusCode == http.StatusOK {
-		var respBody struct {
-			Status  string   `json:"status"`
-			Accrual *float64 `json:"accrual,omitempty"`
-		}
-		err = json.NewDecoder(resp.Body).Decode(&respBody)
-		if err != nil {
-			return err
+	// временный сбой не делает заказ недействительным, проверим его позже
+	case err != nil:
+		scheduleNextCheck(&order, time.Now())
+		if saveErr := s.aRepo.Save(ctx, order); saveErr != nil {
+			return saveErr
 		}
+		return err
 
-		if respBody.Status == "REGISTERED" {
-			order.Status = model.StatusProcessing
-		}
+	case result.Status == model.AccrualRegistered, result.Status == model.AccrualProcessing:
+		order.Status = model.StatusProcessing
 
-		if respBody.Status == "INVALID" {
-			order.Status = model.StatusInvalid
-		}
+	case result.Status == model.AccrualInvalid:
+		order.Status = model.StatusInvalid
 
-		if respBody.Status == "PROCESSING" {
-			order.Status = model.StatusProcessing
-		}
+	case result.Status == model.AccrualProcessed:
+		order.Status = model.StatusProcessed
+		order.Sum = result.Accrual
+	}
 
-		if respBody.Status == "PROCESSED" {
-			order.Status = model.StatusProcessed
-			order.Sum = respBody.Accrual
+	// незавершённый заказ проверим позже, с нарастающим интервалом
+	if !order.IsFinal() {
+		scheduleNextCheck(&order, time.Now())
+	}
 
-			// меняем баланс пользователю
-			err = changeBalance(s, order.UserID, *respBody.Accrual)
+	// начисление и смена статуса заказа фиксируются вместе
+	return s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		if order.Status == model.StatusProcessed && order.Sum != nil {
+			// зачисляем баллы пользователю
+			err := changeBalance(ctx, s, order, *order.Sum)
 			if err != nil {
 				return err
 			}
 		}
+
+		return s.aRepo.Save(ctx, order)
+	})
+}
+
+func scheduleNextCheck(order *model.Accrual, now time.Time) {
+	delay := checkInterval << min(order.Attempts, 10)
+	if delay > maxCheckInterval {
+		delay = maxCheckInterval
 	}
 
-	return s.aRepo.Save(context.Background(), order)
+	order.Attempts++
+	order.NextCheckAt = now.Add(delay)
 }
 
-func changeBalance(s *syncService, userID uuid.UUID, accrual float64) error {
-	balance, err := s.bRepo.FindByUser(context.Background(), userID)
-	if err != nil {
-		return err
+func changeBalance(ctx context.Context, s *syncService, order model.Accrual, accrual model.Money) error {
+	entry := model.NewAccrualEntry(order.UserID, order.Number, accrual)
+	err := s.lRepo.Post(ctx, entry)
+
+	// баллы за заказ уже были зачислены, осталось лишь обновить его статус
+	if errors.Is(err, storage.ErrDuplicate) {
+		return nil
 	}
 
-	balance.Accrual += accrual
-	return s.bRepo.Save(context.Background(), balance)
+	return err
 }
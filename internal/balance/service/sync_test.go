@@ -0,0 +1,295 @@
+package service
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/yury-kuznetsov/gofermart/internal/balance/mock"
+	"github.com/yury-kuznetsov/gofermart/internal/balance/model"
+	txMock "github.com/yury-kuznetsov/gofermart/internal/transaction/mock"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestProcessOrderCreditsOnce(t *testing.T) {
+	order := model.Accrual{
+		ID:        uuid.New(),
+		UserID:    uuid.New(),
+		Number:    "12345678903",
+		Status:    model.StatusNew,
+		CreatedAt: time.Now(),
+	}
+
+	bRepo := &mock.BalanceRepo{}
+	lRepo := &mock.LedgerRepo{Balances: bRepo}
+	aRepo := &mock.AccrualRepo{}
+	_ = aRepo.Save(context.Background(), order)
+	sum := model.Money(72998)
+	client := &mock.AccrualClient{Results: map[string]model.AccrualResult{
+		order.Number: {Order: order.Number, Status: model.AccrualProcessed, Accrual: &sum},
+	}}
+	s := &syncService{tx: &txMock.TxManager{}, lRepo: lRepo, aRepo: aRepo, client: client}
+
+	// повторная обработка того же заказа (например, после сбоя сохранения статуса)
+	// не должна зачислить баллы второй раз
+	assert.NoError(t, processOrder(context.Background(), s, order))
+	assert.NoError(t, processOrder(context.Background(), s, order))
+
+	balance, err := bRepo.FindByUser(context.Background(), order.UserID)
+	assert.NoError(t, err)
+	assert.Equal(t, model.Money(72998), balance.Accrual)
+
+	saved, err := aRepo.FindByNumber(context.Background(), order.Number)
+	assert.NoError(t, err)
+	assert.Equal(t, model.StatusProcessed, saved.Status)
+}
+
+func TestProcessOrderKeepsPolling(t *testing.T) {
+	order := model.Accrual{
+		ID:        uuid.New(),
+		UserID:    uuid.New(),
+		Number:    "12345678903",
+		Status:    model.StatusNew,
+		CreatedAt: time.Now(),
+	}
+
+	aRepo := &mock.AccrualRepo{}
+	_ = aRepo.Save(context.Background(), order)
+	s := &syncService{tx: &txMock.TxManager{}, aRepo: aRepo, client: &mock.AccrualClient{}}
+
+	assert.NoError(t, processOrder(context.Background(), s, order))
+
+	saved, err := aRepo.FindByNumber(context.Background(), order.Number)
+	assert.NoError(t, err)
+	assert.Equal(t, model.StatusProcessing, saved.Status)
+	assert.Equal(t, 1, saved.Attempts)
+	assert.True(t, saved.NextCheckAt.After(time.Now()))
+
+	// до наступления времени следующей проверки заказ не выбирается
+	orders, err := aRepo.ClaimForSync(context.Background(), "test", 10, time.Minute)
+	assert.NoError(t, err)
+	assert.Empty(t, orders)
+}
+
+func TestScheduleNextCheck(t *testing.T) {
+	now := time.Now()
+	order := model.Accrual{}
+
+	scheduleNextCheck(&order, now)
+	assert.Equal(t, now.Add(checkInterval), order.NextCheckAt)
+
+	scheduleNextCheck(&order, now)
+	assert.Equal(t, now.Add(2*checkInterval), order.NextCheckAt)
+
+	// интервал не растёт бесконечно
+	order.Attempts = 50
+	scheduleNextCheck(&order, now)
+	assert.Equal(t, now.Add(maxCheckInterval), order.NextCheckAt)
+}
+
+func TestWorkersProcessQueue(t *testing.T) {
+	bRepo := &mock.BalanceRepo{}
+	aRepo := &mock.AccrualRepo{}
+	client := &mock.AccrualClient{Results: map[string]model.AccrualResult{}}
+	s := NewSyncService(&txMock.TxManager{}, &mock.LedgerRepo{Balances: bRepo}, aRepo, client, 4).(*syncService)
+
+	// заказы одного пользователя разбирают несколько обработчиков
+	userID := uuid.New()
+	sum := 10 * model.Point
+	jobs := make(chan model.Accrual, 20)
+	for i := 0; i < 20; i++ {
+		order := model.Accrual{ID: uuid.New(), UserID: userID, Number: luhnNumber(2000 + i), Status: model.StatusNew}
+		client.Results[order.Number] = model.AccrualResult{Status: model.AccrualProcessed, Accrual: &sum}
+		_ = aRepo.Save(context.Background(), order)
+		jobs <- order
+	}
+	close(jobs)
+
+	var wg sync.WaitGroup
+	for i := 0; i < s.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.work(context.Background(), context.Background(), jobs)
+		}()
+	}
+	wg.Wait()
+
+	balance, err := bRepo.FindByUser(context.Background(), userID)
+	assert.NoError(t, err)
+	assert.Equal(t, 200*model.Point, balance.Accrual)
+}
+
+func TestRateLimiterPause(t *testing.T) {
+	limiter := &rateLimiter{}
+	limiter.PauseFor(50 * time.Millisecond)
+
+	// более короткая пауза не сокращает уже назначенную
+	limiter.PauseFor(time.Millisecond)
+
+	start := time.Now()
+	assert.NoError(t, limiter.Wait(context.Background()))
+	assert.GreaterOrEqual(t, time.Since(start), 40*time.Millisecond)
+
+	// после паузы ожидания нет
+	start = time.Now()
+	assert.NoError(t, limiter.Wait(context.Background()))
+	assert.Less(t, time.Since(start), 10*time.Millisecond)
+
+	// ожидание прерывается остановкой сервиса
+	limiter.PauseFor(time.Hour)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, limiter.Wait(ctx), context.Canceled)
+}
+
+func TestStartStopsOnCancel(t *testing.T) {
+	s := NewSyncService(&txMock.TxManager{}, &mock.LedgerRepo{}, &mock.AccrualRepo{}, &mock.AccrualClient{}, 2)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.Start(ctx, context.Background())
+		close(done)
+	}()
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("sync service did not stop after cancel")
+	}
+}
+
+func TestClaimForSyncLease(t *testing.T) {
+	aRepo := &mock.AccrualRepo{}
+	order := model.Accrual{ID: uuid.New(), UserID: uuid.New(), Number: "12345678903", Status: model.StatusNew}
+	_ = aRepo.Save(context.Background(), order)
+
+	// арендованный заказ не достаётся другому экземпляру
+	orders, err := aRepo.ClaimForSync(context.Background(), "first", 10, time.Minute)
+	assert.NoError(t, err)
+	assert.Len(t, orders, 1)
+
+	orders, err = aRepo.ClaimForSync(context.Background(), "second", 10, time.Minute)
+	assert.NoError(t, err)
+	assert.Empty(t, orders)
+
+	// после сохранения статуса аренда снимается
+	_ = aRepo.Save(context.Background(), order)
+	orders, err = aRepo.ClaimForSync(context.Background(), "crashed", 10, -time.Second)
+	assert.NoError(t, err)
+	assert.Len(t, orders, 1)
+
+	// истёкшая аренда упавшего экземпляра забирается повторно
+	orders, err = aRepo.ClaimForSync(context.Background(), "second", 10, time.Minute)
+	assert.NoError(t, err)
+	assert.Len(t, orders, 1)
+}
+
+func TestProcessOrderTransientError(t *testing.T) {
+	order := model.Accrual{ID: uuid.New(), UserID: uuid.New(), Number: "12345678903", Status: model.StatusNew}
+
+	aRepo := &mock.AccrualRepo{}
+	_ = aRepo.Save(context.Background(), order)
+	client := &mock.AccrualClient{Errors: map[string]error{
+		order.Number: &errServer{StatusCode: http.StatusInternalServerError},
+	}}
+	s := &syncService{tx: &txMock.TxManager{}, aRepo: aRepo, client: client}
+
+	// ошибка сервера не делает заказ недействительным
+	assert.Error(t, processOrder(context.Background(), s, order))
+
+	saved, err := aRepo.FindByNumber(context.Background(), order.Number)
+	assert.NoError(t, err)
+	assert.Equal(t, model.StatusNew, saved.Status)
+	assert.Equal(t, 1, saved.Attempts)
+}
+
+func TestProcessOrderNotRegistered(t *testing.T) {
+	order := model.Accrual{ID: uuid.New(), UserID: uuid.New(), Number: "12345678903", Status: model.StatusNew}
+
+	aRepo := &mock.AccrualRepo{}
+	_ = aRepo.Save(context.Background(), order)
+	client := &mock.AccrualClient{Errors: map[string]error{order.Number: ErrOrderNotRegistered}}
+	s := &syncService{tx: &txMock.TxManager{}, aRepo: aRepo, client: client}
+
+	assert.NoError(t, processOrder(context.Background(), s, order))
+
+	saved, err := aRepo.FindByNumber(context.Background(), order.Number)
+	assert.NoError(t, err)
+	assert.Equal(t, model.StatusInvalid, saved.Status)
+}
+
+// blockingClient отвечает на запрос только после закрытия release
+type blockingClient struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (c *blockingClient) GetOrder(ctx context.Context, number string) (model.AccrualResult, error) {
+	close(c.started)
+	select {
+	case <-c.release:
+	case <-ctx.Done():
+		return model.AccrualResult{}, ctx.Err()
+	}
+
+	sum := model.Money(500)
+	return model.AccrualResult{Order: number, Status: model.AccrualProcessed, Accrual: &sum}, nil
+}
+
+func TestWorkFinishesStartedOrder(t *testing.T) {
+	order := model.Accrual{ID: uuid.New(), UserID: uuid.New(), Number: "12345678903", Status: model.StatusNew}
+
+	aRepo := &mock.AccrualRepo{}
+	_ = aRepo.Save(context.Background(), order)
+	client := &blockingClient{started: make(chan struct{}), release: make(chan struct{})}
+	s := &syncService{
+		tx:      &txMock.TxManager{},
+		lRepo:   &mock.LedgerRepo{Balances: &mock.BalanceRepo{}},
+		aRepo:   aRepo,
+		client:  client,
+		limiter: &rateLimiter{},
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	jobs := make(chan model.Accrual, 1)
+	jobs <- order
+	done := make(chan struct{})
+	go func() {
+		s.work(ctx, context.Background(), jobs)
+		close(done)
+	}()
+
+	// сигнал остановки приходит, пока заказ обрабатывается
+	<-client.started
+	stop()
+	close(client.release)
+	close(jobs)
+	<-done
+
+	saved, err := aRepo.FindByNumber(context.Background(), order.Number)
+	assert.NoError(t, err)
+	assert.Equal(t, model.StatusProcessed, saved.Status)
+}
+
+func TestProcessOrderStopped(t *testing.T) {
+	order := model.Accrual{ID: uuid.New(), UserID: uuid.New(), Number: "12345678903", Status: model.StatusNew}
+
+	aRepo := &mock.AccrualRepo{}
+	_ = aRepo.Save(context.Background(), order)
+	s := &syncService{tx: &txMock.TxManager{}, aRepo: aRepo, client: &mock.AccrualClient{}}
+
+	// прерванный заказ не считается проверенным: попытка не засчитывается
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, processOrder(ctx, s, order), context.Canceled)
+
+	saved, err := aRepo.FindByNumber(context.Background(), order.Number)
+	assert.NoError(t, err)
+	assert.Equal(t, model.StatusNew, saved.Status)
+	assert.Zero(t, saved.Attempts)
+}
@@ -5,29 +5,45 @@ import (
 	"errors"
 	"github.com/google/uuid"
 	"github.com/yury-kuznetsov/gofermart/internal/balance/model"
+	"github.com/yury-kuznetsov/gofermart/internal/storage"
+	"github.com/yury-kuznetsov/gofermart/internal/transaction"
 	"github.com/yury-kuznetsov/gofermart/internal/validation"
 	"time"
 )
 
 var ErrIncorrectOrder = errors.New("некорректный номер заказа")
 var ErrInsufficientFunds = errors.New("на счету недостаточно средств")
+var ErrAlreadyWithdrawn = errors.New("по этому заказу уже было списание")
+var ErrIncorrectSum = errors.New("сумма списания должна быть положительной")
+var ErrBalanceBusy = errors.New("баланс одновременно изменяется другими запросами, повторите позже")
+
+// сколько раз повторять списание, если баланс изменился параллельно
+const withdrawAttempts = 5
 
 type WithdrawalsRepository interface {
 	Create(ctx context.Context, withdrawal model.Withdrawal) error
 	FindByUser(ctx context.Context, userID uuid.UUID) ([]model.Withdrawal, error)
+	FindPage(ctx context.Context, userID uuid.UUID, page model.PageQuery) ([]model.Withdrawal, error)
+	Total(ctx context.Context, userID uuid.UUID, page model.PageQuery) (model.Money, error)
 }
 
 type WithdrawalService struct {
+	tx    transaction.TxManager
 	bRepo BalanceRepository
+	lRepo LedgerRepository
 	wRepo WithdrawalsRepository
 }
 
 func NewWithdrawalService(
+	tx transaction.TxManager,
 	bRepo BalanceRepository,
+	lRepo LedgerRepository,
 	wRepo WithdrawalsRepository,
 ) *WithdrawalService {
 	return &WithdrawalService{
+		tx:    tx,
 		bRepo: bRepo,
+		lRepo: lRepo,
 		wRepo: wRepo,
 	}
 }
@@ -36,61 +52,101 @@ func (s *WithdrawalService) Withdraw(
 	ctx context.Context,
 	userID uuid.UUID,
 	order string,
-	sum float64,
+	sum model.Money,
 ) error {
-	/*
-		Нужен механизм транзакции, но описывать его тут кажется неуместно.
-		Сервис не должен знать про всякие `db.Begin()` или `tx.Rollback()`.
-		Где в таком случае его размещать - открытый вопрос к ревьюеру.
-
-		tx, err := s.db.Begin()
-		if err != nil {
-			return err
-		}
-		defer func() {
-			if err != nil {
-				_ = tx.Rollback()
-				return
-			}
-			err = tx.Commit()
-		}()
-	*/
-
 	// проверяем корректность номера заказа
 	if !validation.IsValidLuhn(order) {
 		return ErrIncorrectOrder
 	}
 
-	// получаем баланс пользователя
-	balance, err := s.bRepo.FindByUser(ctx, userID)
-	if err != nil {
-		return err
+	// нулевое или отрицательное списание увеличило бы баланс
+	if sum <= 0 {
+		return ErrIncorrectSum
 	}
 
-	// проверяем наличие суммы для списания
-	if (balance.Accrual - balance.Withdrawal) < sum {
-		return ErrInsufficientFunds
+	// при параллельном изменении баланса повторяем попытку с актуальными данными
+	var err error
+	for attempt := 0; attempt < withdrawAttempts; attempt++ {
+		err = s.withdraw(ctx, userID, order, sum)
+		if !errors.Is(err, storage.ErrConflict) {
+			return err
+		}
 	}
 
-	// увеличиваем показатель использованных средств
-	balance.Withdrawal += sum
-	err = s.bRepo.Save(ctx, balance)
-	if err != nil {
-		return err
-	}
+	return ErrBalanceBusy
+}
 
-	// сохраняем событие списания
-	withdrawal := model.Withdrawal{
-		ID:        uuid.New(),
-		UserID:    userID,
-		Number:    order,
-		Sum:       sum,
-		CreatedAt: time.Now(),
-	}
+func (s *WithdrawalService) withdraw(
+	ctx context.Context,
+	userID uuid.UUID,
+	order string,
+	sum model.Money,
+) error {
+	// проверка баланса, списание и его регистрация выполняются в одной транзакции
+	return s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		// получаем баланс пользователя
+		balance, err := s.bRepo.FindByUser(ctx, userID)
+		if err != nil {
+			return err
+		}
 
-	return s.wRepo.Create(ctx, withdrawal)
+		// проверяем наличие суммы для списания
+		if (balance.Accrual - balance.Withdrawal) < sum {
+			return ErrInsufficientFunds
+		}
+
+		// проводим списание по журналу, снимок баланса обновится вместе с ним,
+		// если с момента проверки его никто не изменил
+		entry := model.NewWithdrawalEntry(userID, order, sum)
+		entry.BalanceVersion = &balance.Version
+		err = s.lRepo.Post(ctx, entry)
+		if errors.Is(err, storage.ErrDuplicate) {
+			return ErrAlreadyWithdrawn
+		}
+		if err != nil {
+			return err
+		}
+
+		// сохраняем событие списания
+		withdrawal := model.Withdrawal{
+			ID:        uuid.New(),
+			UserID:    userID,
+			Number:    order,
+			Sum:       sum,
+			CreatedAt: time.Now(),
+		}
+
+		return s.wRepo.Create(ctx, withdrawal)
+	})
 }
 
 func (s *WithdrawalService) GetWithdrawals(ctx context.Context, userID uuid.UUID) ([]model.Withdrawal, error) {
 	return s.wRepo.FindByUser(ctx, userID)
 }
+
+// GetWithdrawalsPage возвращает страницу списаний и курсор следующей страницы, если она есть
+func (s *WithdrawalService) GetWithdrawalsPage(
+	ctx context.Context,
+	userID uuid.UUID,
+	page model.PageQuery,
+) ([]model.Withdrawal, *model.Cursor, error) {
+	return fetchPage(
+		page.Limit,
+		func(limit int) ([]model.Withdrawal, error) {
+			page.Limit = limit
+			return s.wRepo.FindPage(ctx, userID, page)
+		},
+		func(withdrawal model.Withdrawal) (time.Time, uuid.UUID) {
+			return withdrawal.CreatedAt, withdrawal.ID
+		},
+	)
+}
+
+// GetWithdrawalsTotal возвращает сумму списаний за период выборки, независимо от страницы
+func (s *WithdrawalService) GetWithdrawalsTotal(
+	ctx context.Context,
+	userID uuid.UUID,
+	page model.PageQuery,
+) (model.Money, error) {
+	return s.wRepo.Total(ctx, userID, page)
+}
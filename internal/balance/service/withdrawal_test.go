@@ -2,50 +2,77 @@ package service
 
 import (
 	"context"
+	"errors"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/yury-kuznetsov/gofermart/internal/balance/mock"
 	"github.com/yury-kuznetsov/gofermart/internal/balance/model"
+	"github.com/yury-kuznetsov/gofermart/internal/storage"
+	txMock "github.com/yury-kuznetsov/gofermart/internal/transaction/mock"
+	"github.com/yury-kuznetsov/gofermart/internal/validation"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestWithdraw(t *testing.T) {
 	userID := uuid.New()
 	balance := model.Balance{
 		UserID:     userID,
-		Accrual:    100,
-		Withdrawal: 20,
+		Accrual:    100 * model.Point,
+		Withdrawal: 20 * model.Point,
 	}
 
 	bRepo := &mock.BalanceRepo{}
 	_ = bRepo.Save(context.Background(), balance)
+	lRepo := &mock.LedgerRepo{Balances: bRepo}
 	wRepo := &mock.WithdrawalRepo{}
-	srv := &WithdrawalService{bRepo: bRepo, wRepo: wRepo}
+	srv := &WithdrawalService{tx: &txMock.TxManager{}, bRepo: bRepo, lRepo: lRepo, wRepo: wRepo}
 
 	tests := []struct {
 		name   string
 		number string
-		sum    float64
+		sum    model.Money
 		error  error
 	}{
 		{
 			name:   "InvalidLuhn",
 			number: "123456789",
-			sum:    10,
+			sum:    10 * model.Point,
 			error:  ErrIncorrectOrder,
 		},
+		{
+			name:   "NegativeSum",
+			number: "12345678903",
+			sum:    -10 * model.Point,
+			error:  ErrIncorrectSum,
+		},
+		{
+			name:   "ZeroSum",
+			number: "12345678903",
+			sum:    0,
+			error:  ErrIncorrectSum,
+		},
 		{
 			name:   "InsufficientFunds",
 			number: "12345678903",
-			sum:    90, // на счету 100-20=80 баллов
+			sum:    90 * model.Point, // на счету 100-20=80 баллов
 			error:  ErrInsufficientFunds,
 		},
 		{
 			name:   "Success",
 			number: "12345678903",
-			sum:    70,
+			sum:    70 * model.Point,
 			error:  nil,
 		},
+		{
+			name:   "AlreadyWithdrawn",
+			number: "12345678903",
+			sum:    1 * model.Point,
+			error:  ErrAlreadyWithdrawn,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -58,8 +85,137 @@ func TestWithdraw(t *testing.T) {
 				assert.NoError(t, err)
 				assert.Equal(t, balance.Accrual, row.Accrual)
 				assert.Equal(t, balance.Withdrawal+tt.sum, row.Withdrawal)
+
+				// списание отражено в журнале сбалансированной записью
+				entries, err := lRepo.FindByUser(context.Background(), userID)
+				assert.NoError(t, err)
+				assert.Len(t, entries, 1)
+				assert.Equal(t, model.EntryWithdrawal, entries[0].Kind)
+				assert.True(t, entries[0].IsBalanced())
 			}
 		})
 	}
 
 }
+
+// concurrentTx не сериализует вызовы, чтобы гонки доходили до проверки версии снимка
+type concurrentTx struct{}
+
+func (concurrentTx) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+func TestWithdrawConcurrent(t *testing.T) {
+	userID := uuid.New()
+	bRepo := &mock.BalanceRepo{}
+	_ = bRepo.Save(context.Background(), model.Balance{
+		UserID:  userID,
+		Accrual: 100 * model.Point,
+		Version: 0, // строка, созданная до появления версий
+	})
+	lRepo := &mock.LedgerRepo{Balances: bRepo}
+	wRepo := &mock.WithdrawalRepo{}
+	srv := &WithdrawalService{tx: concurrentTx{}, bRepo: bRepo, lRepo: lRepo, wRepo: wRepo}
+
+	// 50 параллельных списаний по 10 баллов при балансе в 100 баллов
+	const requests = 50
+	var wg sync.WaitGroup
+	var succeeded atomic.Int64
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := srv.Withdraw(context.Background(), userID, luhnNumber(1000+i), 10*model.Point)
+			switch {
+			case err == nil:
+				succeeded.Add(1)
+			case errors.Is(err, ErrInsufficientFunds), errors.Is(err, ErrBalanceBusy):
+			default:
+				t.Errorf("unexpected error: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	row, err := bRepo.FindByUser(context.Background(), userID)
+	assert.NoError(t, err)
+	assert.Positive(t, succeeded.Load())
+	assert.LessOrEqual(t, row.Withdrawal, row.Accrual)
+	assert.Equal(t, model.Money(succeeded.Load())*10*model.Point, row.Withdrawal)
+
+	withdrawals, err := wRepo.FindByUser(context.Background(), userID)
+	assert.NoError(t, err)
+	assert.Len(t, withdrawals, int(succeeded.Load()))
+}
+
+// conflictLedger отклоняет каждую проводку, как если бы баланс постоянно менялся параллельно
+type conflictLedger struct {
+	mock.LedgerRepo
+	posts atomic.Int64
+}
+
+func (l *conflictLedger) Post(context.Context, model.Entry) error {
+	l.posts.Add(1)
+	return storage.ErrConflict
+}
+
+func TestWithdrawBusy(t *testing.T) {
+	userID := uuid.New()
+	bRepo := &mock.BalanceRepo{}
+	_ = bRepo.Save(context.Background(), model.Balance{UserID: userID, Accrual: 100 * model.Point})
+	lRepo := &conflictLedger{}
+	srv := &WithdrawalService{tx: &txMock.TxManager{}, bRepo: bRepo, lRepo: lRepo, wRepo: &mock.WithdrawalRepo{}}
+
+	// после исчерпания попыток возвращается отдельная ошибка, а не конфликт хранилища
+	err := srv.Withdraw(context.Background(), userID, "12345678903", 10*model.Point)
+	assert.ErrorIs(t, err, ErrBalanceBusy)
+	assert.Equal(t, int64(withdrawAttempts), lRepo.posts.Load())
+}
+
+func TestGetWithdrawalsPage(t *testing.T) {
+	userID := uuid.New()
+	wRepo := &mock.WithdrawalRepo{}
+	start := time.Now().Add(-time.Hour)
+	for i := 0; i < 5; i++ {
+		_ = wRepo.Create(context.Background(), model.Withdrawal{
+			ID:        uuid.New(),
+			UserID:    userID,
+			Number:    luhnNumber(1000 + i),
+			Sum:       model.Money(i+1) * model.Point,
+			CreatedAt: start.Add(time.Duration(i) * time.Minute),
+		})
+	}
+	srv := &WithdrawalService{wRepo: wRepo}
+
+	// период без первого и последнего списания, страницы по одному
+	page := model.PageQuery{From: start.Add(time.Minute), To: start.Add(4 * time.Minute), Desc: true, Limit: 1}
+	var numbers []string
+	for {
+		withdrawals, next, err := srv.GetWithdrawalsPage(context.Background(), userID, page)
+		assert.NoError(t, err)
+		for _, withdrawal := range withdrawals {
+			numbers = append(numbers, withdrawal.Number)
+		}
+		if next == nil {
+			break
+		}
+		page.After = next
+	}
+	assert.Equal(t, []string{luhnNumber(1003), luhnNumber(1002), luhnNumber(1001)}, numbers)
+
+	// сумма считается за весь период, а не за последнюю страницу
+	total, err := srv.GetWithdrawalsTotal(context.Background(), userID, page)
+	assert.NoError(t, err)
+	assert.Equal(t, 9*model.Point, total)
+}
+
+// luhnNumber дописывает к числу контрольную цифру по алгоритму Луна
+func luhnNumber(n int) string {
+	number := strconv.Itoa(n)
+	for digit := 0; digit < 10; digit++ {
+		if candidate := number + strconv.Itoa(digit); validation.IsValidLuhn(candidate) {
+			return candidate
+		}
+	}
+	return number
+}
@@ -4,12 +4,15 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/google/uuid"
 	"github.com/yury-kuznetsov/gofermart/internal/balance/model"
 	"github.com/yury-kuznetsov/gofermart/internal/balance/service"
 	"github.com/yury-kuznetsov/gofermart/middleware"
 	"io"
 	"net/http"
+	"net/url"
+	"strings"
 )
 
 type BalanceService interface {
@@ -19,16 +22,19 @@ type BalanceService interface {
 type AccrualService interface {
 	Load(ctx context.Context, userID uuid.UUID, number string) error
 	GetOrders(ctx context.Context, userID uuid.UUID) ([]model.Accrual, error)
+	GetOrdersPage(ctx context.Context, userID uuid.UUID, filter model.AccrualFilter) ([]model.Accrual, *model.Cursor, error)
 }
 
 type WithdrawalService interface {
-	Withdraw(ctx context.Context, userID uuid.UUID, order string, sum float64) error
+	Withdraw(ctx context.Context, userID uuid.UUID, order string, sum model.Money) error
 	GetWithdrawals(ctx context.Context, userID uuid.UUID) ([]model.Withdrawal, error)
+	GetWithdrawalsPage(ctx context.Context, userID uuid.UUID, page model.PageQuery) ([]model.Withdrawal, *model.Cursor, error)
+	GetWithdrawalsTotal(ctx context.Context, userID uuid.UUID, page model.PageQuery) (model.Money, error)
 }
 
 type withdrawRequest struct {
-	Order string  `json:"order"`
-	Sum   float64 `json:"sum"`
+	Order string      `json:"order"`
+	Sum   model.Money `json:"sum"`
 }
 
 func GetBalanceHandler(s BalanceService) http.HandlerFunc {
@@ -86,8 +92,22 @@ func GetOrdersHandler(s AccrualService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		userID := middleware.GetUserID(r.Context())
 
-		// получение заказов пользователя
-		orders, err := s.GetOrders(r.Context(), userID)
+		// без параметров отдаём все заказы пользователя, как и раньше
+		var orders []model.Accrual
+		var err error
+		if len(r.URL.Query()) == 0 {
+			orders, err = s.GetOrders(r.Context(), userID)
+		} else {
+			var filter model.AccrualFilter
+			if filter, err = parseAccrualFilter(r.URL.Query()); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			var next *model.Cursor
+			orders, next, err = s.GetOrdersPage(r.Context(), userID, filter)
+			setNextLink(w, r, next)
+		}
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -107,6 +127,29 @@ func GetOrdersHandler(s AccrualService) http.HandlerFunc {
 	}
 }
 
+// parseAccrualFilter разбирает параметры выборки заказов, статусы перечисляются через запятую
+func parseAccrualFilter(query url.Values) (model.AccrualFilter, error) {
+	page, err := parsePageQuery(query)
+	filter := model.AccrualFilter{PageQuery: page}
+	if err != nil {
+		return filter, err
+	}
+
+	if statuses := query.Get("status"); statuses != "" {
+		for _, status := range strings.Split(statuses, ",") {
+			status = strings.ToUpper(strings.TrimSpace(status))
+			switch status {
+			case model.StatusNew, model.StatusProcessing, model.StatusInvalid, model.StatusProcessed:
+				filter.Statuses = append(filter.Statuses, status)
+			default:
+				return filter, fmt.Errorf("%w: неизвестный статус %q", errInvalidQuery, status)
+			}
+		}
+	}
+
+	return filter, nil
+}
+
 func WithdrawHandler(s WithdrawalService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		userID := middleware.GetUserID(r.Context())
@@ -122,10 +165,15 @@ func WithdrawHandler(s WithdrawalService) http.HandlerFunc {
 		err = s.Withdraw(r.Context(), userID, request.Order, request.Sum)
 		if err != nil {
 			switch {
-			case errors.Is(err, service.ErrIncorrectOrder):
+			case errors.Is(err, service.ErrIncorrectOrder), errors.Is(err, service.ErrIncorrectSum):
 				http.Error(w, err.Error(), http.StatusUnprocessableEntity)
 			case errors.Is(err, service.ErrInsufficientFunds):
 				http.Error(w, err.Error(), http.StatusPaymentRequired)
+			case errors.Is(err, service.ErrAlreadyWithdrawn):
+				http.Error(w, err.Error(), http.StatusConflict)
+			case errors.Is(err, service.ErrBalanceBusy):
+				w.Header().Set("Retry-After", "1")
+				http.Error(w, err.Error(), http.StatusServiceUnavailable)
 			default:
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 			}
@@ -140,8 +188,36 @@ func GetWithdrawalsHandler(s WithdrawalService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		userID := middleware.GetUserID(r.Context())
 
-		// получение списаний пользователя
-		withdrawals, err := s.GetWithdrawals(r.Context(), userID)
+		// без параметров отдаём все списания пользователя, как и раньше
+		var withdrawals []model.Withdrawal
+		var err error
+		if len(r.URL.Query()) == 0 {
+			withdrawals, err = s.GetWithdrawals(r.Context(), userID)
+		} else {
+			// у списаний нет статуса, фильтр по нему не должен молча игнорироваться
+			if r.URL.Query().Has("status") {
+				http.Error(w, fmt.Sprintf("%v: у списаний нет параметра status", errInvalidQuery), http.StatusBadRequest)
+				return
+			}
+
+			var page model.PageQuery
+			if page, err = parsePageQuery(r.URL.Query()); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			// сумма списаний за весь период выборки, а не только за страницу
+			var total model.Money
+			if total, err = s.GetWithdrawalsTotal(r.Context(), userID, page); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("X-Total-Sum", total.String())
+
+			var next *model.Cursor
+			withdrawals, next, err = s.GetWithdrawalsPage(r.Context(), userID, page)
+			setNextLink(w, r, next)
+		}
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"github.com/yury-kuznetsov/gofermart/internal/balance/model"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var errInvalidQuery = errors.New("некорректные параметры запроса")
+
+// parsePageQuery разбирает общие параметры постраничной выдачи:
+// limit, cursor, direction (asc или desc), from и to в формате RFC3339
+func parsePageQuery(query url.Values) (model.PageQuery, error) {
+	page := model.PageQuery{Limit: model.DefaultPageLimit}
+
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > model.MaxPageLimit {
+			return page, fmt.Errorf("%w: limit должен быть от 1 до %d", errInvalidQuery, model.MaxPageLimit)
+		}
+		page.Limit = n
+	}
+
+	if cursor := query.Get("cursor"); cursor != "" {
+		after, err := model.ParseCursor(cursor)
+		if err != nil {
+			return page, fmt.Errorf("%w: %w", errInvalidQuery, err)
+		}
+		page.After = &after
+	}
+
+	switch strings.ToLower(query.Get("direction")) {
+	case "", "asc":
+	case "desc":
+		page.Desc = true
+	default:
+		return page, fmt.Errorf("%w: direction должен быть asc или desc", errInvalidQuery)
+	}
+
+	var err error
+	if page.From, err = parseTime(query, "from"); err != nil {
+		return page, err
+	}
+	if page.To, err = parseTime(query, "to"); err != nil {
+		return page, err
+	}
+
+	return page, nil
+}
+
+func parseTime(query url.Values, name string) (time.Time, error) {
+	value := query.Get(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return t, fmt.Errorf("%w: %s должен быть в формате RFC3339", errInvalidQuery, name)
+	}
+
+	return t, nil
+}
+
+// setNextLink сообщает клиенту адрес следующей страницы с теми же параметрами выборки
+func setNextLink(w http.ResponseWriter, r *http.Request, next *model.Cursor) {
+	if next == nil {
+		return
+	}
+
+	query := r.URL.Query()
+	query.Set("cursor", next.String())
+	link := url.URL{Path: r.URL.Path, RawQuery: query.Encode()}
+	w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"next\"", link.String()))
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/yury-kuznetsov/gofermart/internal/user/service"
+	"github.com/yury-kuznetsov/gofermart/middleware"
+	"math"
+	"net/http"
+	"strconv"
+)
+
+type PasswordService interface {
+	ChangePassword(ctx context.Context, userID uuid.UUID, current, password string) error
+	RequestReset(ctx context.Context, login, ip string) error
+	ResetPassword(ctx context.Context, token, password string) error
+}
+
+type changePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+type resetRequest struct {
+	Login string `json:"login"`
+}
+
+type resetPasswordRequest struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
+}
+
+// ChangePasswordHandler меняет пароль. Все сессии пользователя, включая текущую,
+// завершаются, поэтому в ответе выдаются токены новой сессии.
+func ChangePasswordHandler(
+	passwordService PasswordService,
+	jwtService JWTService,
+	refreshService RefreshService,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// принимаем запрос
+		var request changePasswordRequest
+		err := json.NewDecoder(r.Body).Decode(&request)
+		if err != nil {
+			http.Error(w, "не переданы current_password или new_password", http.StatusBadRequest)
+			return
+		}
+
+		// меняем пароль
+		userID := middleware.GetUserID(r.Context())
+		err = passwordService.ChangePassword(r.Context(), userID, request.CurrentPassword, request.NewPassword)
+		if err != nil {
+			switch {
+			case errors.Is(err, service.ErrInvalidCredentials):
+				http.Error(w, "неверный текущий пароль", http.StatusForbidden)
+			case errors.Is(err, service.ErrEmptyPassword):
+				http.Error(w, err.Error(), http.StatusBadRequest)
+			default:
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+
+		writeTokens(w, r, userID, jwtService, refreshService)
+	}
+}
+
+// RequestPasswordResetHandler отправляет токен сброса пароля. Ответ не зависит от того,
+// зарегистрирован ли логин.
+func RequestPasswordResetHandler(passwordService PasswordService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// принимаем запрос
+		var request resetRequest
+		err := json.NewDecoder(r.Body).Decode(&request)
+		if err != nil || request.Login == "" {
+			http.Error(w, "не передан login", http.StatusBadRequest)
+			return
+		}
+
+		err = passwordService.RequestReset(r.Context(), request.Login, clientDevice(r).IP)
+		if err != nil {
+			var locked *service.LockedError
+			switch {
+			case errors.As(err, &locked):
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(locked.RetryAfter.Seconds()))))
+				http.Error(w, err.Error(), http.StatusTooManyRequests)
+			case errors.Is(err, service.ErrResetDisabled):
+				http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			default:
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+// ResetPasswordHandler устанавливает новый пароль по токену сброса
+func ResetPasswordHandler(passwordService PasswordService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// принимаем запрос
+		var request resetPasswordRequest
+		err := json.NewDecoder(r.Body).Decode(&request)
+		if err != nil || request.Token == "" {
+			http.Error(w, "не переданы token или new_password", http.StatusBadRequest)
+			return
+		}
+
+		// сбрасываем пароль, все сессии пользователя завершаются
+		err = passwordService.ResetPassword(r.Context(), request.Token, request.NewPassword)
+		if err != nil {
+			switch {
+			case errors.Is(err, service.ErrInvalidResetToken):
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+			case errors.Is(err, service.ErrEmptyPassword):
+				http.Error(w, err.Error(), http.StatusBadRequest)
+			default:
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
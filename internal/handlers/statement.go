@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/yury-kuznetsov/gofermart/internal/balance/model"
+	"github.com/yury-kuznetsov/gofermart/internal/balance/service"
+	"github.com/yury-kuznetsov/gofermart/middleware"
+	"io"
+	"net/http"
+	"time"
+)
+
+type StatementService interface {
+	Write(ctx context.Context, userID uuid.UUID, period model.PageQuery, w service.StatementWriter) error
+}
+
+// строки остатков на начало и конец периода
+const (
+	statementOpening = "OPENING"
+	statementClosing = "CLOSING"
+)
+
+// GetStatementHandler выгружает выписку по счёту в формате csv, json (по умолчанию) или ndjson.
+// Выписка читается из хранилища порциями и пишется в ответ по мере чтения, без загрузки в память целиком.
+func GetStatementHandler(s StatementService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := middleware.GetUserID(r.Context())
+		query := r.URL.Query()
+
+		// период выписки
+		var period model.PageQuery
+		var err error
+		if period.From, err = parseTime(query, "from"); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if period.To, err = parseTime(query, "to"); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !period.From.IsZero() && !period.To.IsZero() && !period.From.Before(period.To) {
+			http.Error(w, fmt.Sprintf("%v: from должен быть раньше to", errInvalidQuery), http.StatusBadRequest)
+			return
+		}
+
+		// формат выписки
+		response := &statementResponse{w: w}
+		var writer service.StatementWriter
+		switch query.Get("format") {
+		case "", "json":
+			w.Header().Set("content-type", "application/json")
+			writer = &jsonStatementWriter{w: response}
+		case "ndjson":
+			w.Header().Set("content-type", "application/x-ndjson")
+			writer = &ndjsonStatementWriter{enc: json.NewEncoder(response)}
+		case "csv":
+			w.Header().Set("content-type", "text/csv; charset=utf-8")
+			w.Header().Set("content-disposition", `attachment; filename="statement.csv"`)
+			writer = &csvStatementWriter{w: csv.NewWriter(response)}
+		default:
+			http.Error(w, fmt.Sprintf("%v: format должен быть csv, json или ndjson", errInvalidQuery), http.StatusBadRequest)
+			return
+		}
+
+		err = s.Write(r.Context(), userID, period, writer)
+		if err == nil {
+			return
+		}
+
+		// после начала ответа сменить статус уже нельзя, клиент получит оборванную выписку
+		if response.started {
+			fmt.Println(err)
+			return
+		}
+		w.Header().Del("content-disposition")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// statementResponse запоминает, что клиенту уже начали отправлять выписку
+type statementResponse struct {
+	w       io.Writer
+	started bool
+}
+
+func (r *statementResponse) Write(p []byte) (int, error) {
+	r.started = true
+	return r.w.Write(p)
+}
+
+// jsonStatementWriter пишет выписку одним JSON-объектом
+type jsonStatementWriter struct {
+	w     io.Writer
+	lines int
+}
+
+func (j *jsonStatementWriter) Begin(opening model.Money) error {
+	data, err := json.Marshal(opening)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(j.w, `{"opening_balance":%s,"lines":[`, data)
+	return err
+}
+
+func (j *jsonStatementWriter) Line(line model.StatementLine) error {
+	data, err := json.Marshal(line)
+	if err != nil {
+		return err
+	}
+	if j.lines > 0 {
+		data = append([]byte{','}, data...)
+	}
+	j.lines++
+
+	_, err = j.w.Write(data)
+	return err
+}
+
+func (j *jsonStatementWriter) End(closing model.Money) error {
+	data, err := json.Marshal(closing)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(j.w, `],"closing_balance":%s}`, data)
+	return err
+}
+
+// ndjsonStatementWriter пишет каждую строку выписки отдельным JSON-объектом
+type ndjsonStatementWriter struct {
+	enc *json.Encoder
+}
+
+type ndjsonBalance struct {
+	Kind    string      `json:"type"`
+	Balance model.Money `json:"balance"`
+}
+
+func (n *ndjsonStatementWriter) Begin(opening model.Money) error {
+	return n.enc.Encode(ndjsonBalance{Kind: statementOpening, Balance: opening})
+}
+
+func (n *ndjsonStatementWriter) Line(line model.StatementLine) error {
+	return n.enc.Encode(line)
+}
+
+func (n *ndjsonStatementWriter) End(closing model.Money) error {
+	return n.enc.Encode(ndjsonBalance{Kind: statementClosing, Balance: closing})
+}
+
+// csvStatementWriter пишет выписку таблицей, остатки на начало и конец - отдельными строками
+type csvStatementWriter struct {
+	w *csv.Writer
+}
+
+func (c *csvStatementWriter) Begin(opening model.Money) error {
+	if err := c.w.Write([]string{"time", "type", "order", "amount", "balance"}); err != nil {
+		return err
+	}
+	return c.w.Write([]string{"", statementOpening, "", "", opening.String()})
+}
+
+func (c *csvStatementWriter) Line(line model.StatementLine) error {
+	return c.w.Write([]string{
+		line.Time.Format(time.RFC3339),
+		line.Kind,
+		line.Order,
+		line.Amount.String(),
+		line.Balance.String(),
+	})
+}
+
+func (c *csvStatementWriter) End(closing model.Money) error {
+	if err := c.w.Write([]string{"", statementClosing, "", "", closing.String()}); err != nil {
+		return err
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
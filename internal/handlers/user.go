@@ -5,9 +5,13 @@ import (
 	"encoding/json"
 	"errors"
 	"github.com/google/uuid"
+	"github.com/yury-kuznetsov/gofermart/internal/user/model"
 	"github.com/yury-kuznetsov/gofermart/internal/user/service"
 	"github.com/yury-kuznetsov/gofermart/middleware"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
 )
 
 type UserService interface {
@@ -16,7 +20,25 @@ type UserService interface {
 }
 
 type JWTService interface {
-	GenerateToken(userID uuid.UUID) string
+	GenerateToken(ctx context.Context, userID, sessionID uuid.UUID) (string, error)
+	Revoke(ctx context.Context, token string) (uuid.UUID, error)
+	RevokeAll(ctx context.Context, userID uuid.UUID) error
+}
+
+type RefreshService interface {
+	Issue(ctx context.Context, userID uuid.UUID, device model.Device) (service.Session, error)
+	Rotate(ctx context.Context, token string, device model.Device) (service.Session, error)
+	RevokeSession(ctx context.Context, sessionID uuid.UUID) error
+	RevokeAll(ctx context.Context, userID uuid.UUID) error
+}
+
+type LoginGuard interface {
+	Reserve(ctx context.Context, login, ip string) error
+	Succeed(ctx context.Context, login, ip string) error
+}
+
+type JWKSService interface {
+	JWKS() service.JWKS
 }
 
 type registerRequest struct {
@@ -29,7 +51,22 @@ type loginRequest struct {
 	Password string `json:"password"`
 }
 
-func RegisterHandler(userService UserService, jwtService JWTService) http.HandlerFunc {
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+func RegisterHandler(
+	userService UserService,
+	jwtService JWTService,
+	refreshService RefreshService,
+) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// принимаем запрос
 		var request registerRequest
@@ -50,19 +87,17 @@ func RegisterHandler(userService UserService, jwtService JWTService) http.Handle
 			return
 		}
 
-		// генерируем токен и сохраняем в куки
-		token := jwtService.GenerateToken(userID)
-		http.SetCookie(w, &http.Cookie{
-			Name:  middleware.CookieKey,
-			Value: token,
-		})
-		w.Header().Set("Authorization", token)
-
-		w.WriteHeader(http.StatusOK)
+		// выдаём токены новой сессии
+		writeTokens(w, r, userID, jwtService, refreshService)
 	}
 }
 
-func LoginHandler(userService UserService, jwtService JWTService) http.HandlerFunc {
+func LoginHandler(
+	userService UserService,
+	jwtService JWTService,
+	refreshService RefreshService,
+	loginGuard LoginGuard,
+) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// принимаем запрос
 		var request loginRequest
@@ -72,6 +107,20 @@ func LoginHandler(userService UserService, jwtService JWTService) http.HandlerFu
 			return
 		}
 
+		// попытка учитывается до проверки пароля, а после серии неудачных
+		// пароль не проверяем до истечения задержки
+		ip := clientDevice(r).IP
+		if err := loginGuard.Reserve(r.Context(), request.Login, ip); err != nil {
+			var locked *service.LockedError
+			if errors.As(err, &locked) {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(locked.RetryAfter.Seconds()))))
+				http.Error(w, err.Error(), http.StatusTooManyRequests)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
 		// авторизуем пользователя
 		userID, err := userService.Login(r.Context(), request.Login, request.Password)
 		if err != nil {
@@ -83,14 +132,179 @@ func LoginHandler(userService UserService, jwtService JWTService) http.HandlerFu
 			return
 		}
 
-		// генерируем токен и сохраняем в куки
-		token := jwtService.GenerateToken(userID)
-		http.SetCookie(w, &http.Cookie{
-			Name:  middleware.CookieKey,
-			Value: token,
-		})
-		w.Header().Set("Authorization", token)
+		if err := loginGuard.Succeed(r.Context(), request.Login, ip); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// выдаём токены новой сессии
+		writeTokens(w, r, userID, jwtService, refreshService)
+	}
+}
+
+// RefreshHandler обменивает токен обновления на новую пару токенов.
+// Токен принимается в теле запроса или в куки, выставленной при входе.
+func RefreshHandler(jwtService JWTService, refreshService RefreshService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// принимаем запрос
+		var request refreshRequest
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+				http.Error(w, "некорректный формат запроса", http.StatusBadRequest)
+				return
+			}
+		}
+		if request.RefreshToken == "" {
+			if cookie, err := r.Cookie(refreshCookieKey); err == nil {
+				request.RefreshToken = cookie.Value
+			}
+		}
+		if request.RefreshToken == "" {
+			http.Error(w, "не передан refresh_token", http.StatusBadRequest)
+			return
+		}
+
+		// обмениваем токен, предыдущий перестаёт действовать
+		session, err := refreshService.Rotate(r.Context(), request.RefreshToken, clientDevice(r))
+		if err != nil {
+			if errors.Is(err, service.ErrInvalidRefreshToken) || errors.Is(err, service.ErrRefreshTokenReused) {
+				clearTokens(w)
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		writeTokenPair(w, r, jwtService, session)
+	}
+}
 
+// LogoutHandler завершает текущую сессию: отзывает токен запроса и токены обновления сессии
+func LogoutHandler(jwtService JWTService, refreshService RefreshService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sessionID, err := jwtService.Revoke(r.Context(), middleware.GetToken(r.Context()))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if err := refreshService.RevokeSession(r.Context(), sessionID); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		clearTokens(w)
 		w.WriteHeader(http.StatusOK)
 	}
 }
+
+// LogoutAllHandler завершает все сессии пользователя на всех устройствах
+func LogoutAllHandler(jwtService JWTService, refreshService RefreshService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := middleware.GetUserID(r.Context())
+
+		// сначала отзываем токены обновления, чтобы по ним нельзя было получить новый токен доступа
+		if err := refreshService.RevokeAll(r.Context(), userID); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := jwtService.RevokeAll(r.Context(), userID); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		clearTokens(w)
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func JWKSHandler(s JWKSService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("content-type", "application/json")
+		if err := json.NewEncoder(w).Encode(s.JWKS()); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+// куки с токеном обновления отправляется только на адрес его обмена
+const (
+	refreshCookieKey  = "refresh_token"
+	refreshCookiePath = "/api/user/token"
+)
+
+// writeTokens выдаёт токены новой сессии пользователя
+func writeTokens(
+	w http.ResponseWriter,
+	r *http.Request,
+	userID uuid.UUID,
+	jwtService JWTService,
+	refreshService RefreshService,
+) {
+	session, err := refreshService.Issue(r.Context(), userID, clientDevice(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeTokenPair(w, r, jwtService, session)
+}
+
+// writeTokenPair выдаёт токен доступа сессии и передаёт токены в заголовке, куки и теле ответа
+func writeTokenPair(w http.ResponseWriter, r *http.Request, jwtService JWTService, session service.Session) {
+	token, err := jwtService.GenerateToken(r.Context(), session.UserID, session.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	refreshToken := session.RefreshToken
+
+	http.SetCookie(w, &http.Cookie{
+		Name:  middleware.CookieKey,
+		Value: token,
+	})
+	// токен обновления передаётся только по HTTPS и не отправляется с запросами с чужих сайтов
+	http.SetCookie(w, &http.Cookie{
+		Name:     refreshCookieKey,
+		Value:    refreshToken,
+		Path:     refreshCookiePath,
+		MaxAge:   int(service.RefreshDuration.Seconds()),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	w.Header().Set("Authorization", token)
+
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(tokenResponse{
+		AccessToken:  token,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(service.Duration.Seconds()),
+	})
+}
+
+// clearTokens удаляет куки с токенами
+func clearTokens(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{Name: middleware.CookieKey, MaxAge: -1})
+	http.SetCookie(w, &http.Cookie{
+		Name:     refreshCookieKey,
+		Path:     refreshCookiePath,
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// clientDevice описывает клиента, запросившего токен
+func clientDevice(r *http.Request) model.Device {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+
+	return model.Device{UserAgent: r.UserAgent(), IP: ip}
+}
@@ -0,0 +1,214 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed sql/*.sql
+var files embed.FS
+
+var ErrSchemaOutdated = errors.New("схема базы данных устарела, выполните `gophermart migrate up`")
+var ErrSchemaTooNew = errors.New("схема базы данных новее, чем ожидает эта версия сервиса")
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+func NewMigrator(db *sql.DB) (*Migrator, error) {
+	migrations, err := load()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// load читает файлы вида 0001_name.up.sql и 0001_name.down.sql
+func load() ([]Migration, error) {
+	entries, err := files.ReadDir("sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		name := entry.Name()
+		prefix, rest, ok := strings.Cut(name, "_")
+		if !ok {
+			return nil, fmt.Errorf("некорректное имя миграции %q", name)
+		}
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("некорректное имя миграции %q", name)
+		}
+
+		content, err := files.ReadFile(path.Join("sql", name))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version}
+			byVersion[version] = m
+		}
+
+		switch {
+		case strings.HasSuffix(rest, ".up.sql"):
+			m.Name = strings.TrimSuffix(rest, ".up.sql")
+			m.Up = string(content)
+		case strings.HasSuffix(rest, ".down.sql"):
+			m.Down = string(content)
+		default:
+			return nil, fmt.Errorf("некорректное имя миграции %q", name)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("у миграции %d нет up- или down-скрипта", m.Version)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// Latest возвращает версию схемы, которую ожидает сервис
+func (m *Migrator) Latest() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Version возвращает версию схемы в базе данных
+func (m *Migrator) Version(ctx context.Context) (int, error) {
+	_, err := m.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    integer   not null constraint schema_migrations_pk primary key,
+		applied_at timestamp not null
+	)`)
+	if err != nil {
+		return 0, err
+	}
+
+	var version int
+	err = m.db.QueryRowContext(ctx, "SELECT coalesce(max(version), 0) FROM schema_migrations").Scan(&version)
+
+	return version, err
+}
+
+// Check не даёт запустить сервис на схеме, отличной от ожидаемой
+func (m *Migrator) Check(ctx context.Context) error {
+	version, err := m.Version(ctx)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case version < m.Latest():
+		return fmt.Errorf("%w: версия %d, ожидается %d", ErrSchemaOutdated, version, m.Latest())
+	case version > m.Latest():
+		return fmt.Errorf("%w: версия %d, ожидается %d", ErrSchemaTooNew, version, m.Latest())
+	}
+
+	return nil
+}
+
+// Up применяет все ещё не применённые миграции
+func (m *Migrator) Up(ctx context.Context) error {
+	version, err := m.Version(ctx)
+	if err != nil {
+		return err
+	}
+	if version > m.Latest() {
+		return fmt.Errorf("%w: версия %d, ожидается %d", ErrSchemaTooNew, version, m.Latest())
+	}
+
+	for _, migration := range m.migrations {
+		if migration.Version <= version {
+			continue
+		}
+		err := m.apply(ctx, migration.Up, func(tx *sql.Tx) error {
+			_, err := tx.ExecContext(
+				ctx,
+				"INSERT INTO schema_migrations (version, applied_at) VALUES ($1, $2)",
+				migration.Version, time.Now().Format(time.RFC3339),
+			)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("миграция %04d_%s: %w", migration.Version, migration.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// Down откатывает steps последних применённых миграций
+func (m *Migrator) Down(ctx context.Context, steps int) error {
+	version, err := m.Version(ctx)
+	if err != nil {
+		return err
+	}
+
+	for i := len(m.migrations) - 1; i >= 0 && steps > 0; i-- {
+		migration := m.migrations[i]
+		if migration.Version > version {
+			continue
+		}
+		err := m.apply(ctx, migration.Down, func(tx *sql.Tx) error {
+			_, err := tx.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = $1", migration.Version)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("откат миграции %04d_%s: %w", migration.Version, migration.Name, err)
+		}
+		steps--
+	}
+
+	return nil
+}
+
+// apply выполняет скрипт и отметку о нём в одной транзакции
+func (m *Migrator) apply(ctx context.Context, script string, mark func(tx *sql.Tx) error) (err error) {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	if _, err = tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+
+	return mark(tx)
+}
@@ -0,0 +1,204 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	_ "modernc.org/sqlite"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	migrations, err := load()
+	assert.NoError(t, err)
+	assert.NotEmpty(t, migrations)
+
+	// версии идут подряд, у каждой есть скрипты применения и отката
+	for i, migration := range migrations {
+		assert.Equal(t, i+1, migration.Version)
+		assert.NotEmpty(t, migration.Name)
+		assert.NotEmpty(t, migration.Up)
+		assert.NotEmpty(t, migration.Down)
+	}
+
+	m := &Migrator{migrations: migrations}
+	assert.Equal(t, len(migrations), m.Latest())
+}
+
+func TestUpDownSQLite(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite", ":memory:")
+	require.NoError(t, err)
+	db.SetMaxOpenConns(1)
+	defer db.Close()
+
+	m, err := NewMigrator(db)
+	require.NoError(t, err)
+
+	// пустая база требует миграций
+	assert.ErrorIs(t, m.Check(ctx), ErrSchemaOutdated)
+
+	require.NoError(t, m.Up(ctx))
+	assert.NoError(t, m.Check(ctx))
+
+	// откат и повторное применение последней миграции
+	require.NoError(t, m.Down(ctx, 1))
+	version, err := m.Version(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, m.Latest()-1, version)
+	require.NoError(t, m.Up(ctx))
+
+	// полный откат
+	require.NoError(t, m.Down(ctx, m.Latest()))
+	version, err = m.Version(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, version)
+}
+
+func TestLedgerBackfillSQLite(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite", ":memory:")
+	require.NoError(t, err)
+	db.SetMaxOpenConns(1)
+	defer db.Close()
+
+	m, err := NewMigrator(db)
+	require.NoError(t, err)
+
+	// база в состоянии до переноса балансов в журнал
+	require.NoError(t, m.Up(ctx))
+	version, err := m.Version(ctx)
+	require.NoError(t, err)
+	require.NoError(t, m.Down(ctx, version-9))
+
+	userID := "6f1c1a52-4a4e-4f43-9d5e-1f6f5f0e8a01"
+	for _, query := range []string{
+		`INSERT INTO "user" (id, login, password) VALUES ('` + userID + `', 'user', '')`,
+		`INSERT INTO balance (user_id, accrual, withdrawal) VALUES ('` + userID + `', 150.5, 20)`,
+		`INSERT INTO balance_accrual (id, user_id, number, status, sum, created_at)
+		VALUES ('0b9d5f0e-1d2c-4c8e-8a0e-3f1e2d4c5b01', '` + userID + `', '18', 'PROCESSED', 100.5, '2024-01-01T00:00:00Z'),
+		       ('0b9d5f0e-1d2c-4c8e-8a0e-3f1e2d4c5b02', '` + userID + `', '26', 'NEW', NULL, '2024-01-02T00:00:00Z')`,
+		`INSERT INTO balance_withdrawal (id, user_id, number, sum, created_at)
+		VALUES ('0b9d5f0e-1d2c-4c8e-8a0e-3f1e2d4c5b03', '` + userID + `', '34', 20, '2024-01-03T00:00:00Z')`,
+	} {
+		_, err := db.ExecContext(ctx, query)
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, m.Up(ctx))
+
+	// журнал подтверждает снимок: начисление, списание и остаток до журнала
+	var kinds []string
+	rows, err := db.QueryContext(ctx, "SELECT kind FROM ledger_entry ORDER BY kind")
+	require.NoError(t, err)
+	for rows.Next() {
+		var kind string
+		require.NoError(t, rows.Scan(&kind))
+		kinds = append(kinds, kind)
+	}
+	require.NoError(t, rows.Err())
+	assert.Equal(t, []string{"ACCRUAL", "OPENING", "WITHDRAWAL"}, kinds)
+
+	// после 0012 суммы хранятся в копейках
+	var current, opening, total int64
+	require.NoError(t, db.QueryRowContext(ctx,
+		"SELECT sum(amount) FROM ledger_posting WHERE account = 'user:"+userID+"'",
+	).Scan(&current))
+	require.NoError(t, db.QueryRowContext(ctx,
+		"SELECT -sum(amount) FROM ledger_posting WHERE account = 'system:opening'",
+	).Scan(&opening))
+	require.NoError(t, db.QueryRowContext(ctx, "SELECT sum(amount) FROM ledger_posting").Scan(&total))
+	assert.Equal(t, int64(13050), current)
+	assert.Equal(t, int64(5000), opening)
+	assert.Zero(t, total)
+
+	// откат удаляет только перенесённые записи
+	require.NoError(t, m.Down(ctx, m.Latest()-9))
+	var entries int
+	require.NoError(t, db.QueryRowContext(ctx, "SELECT count(*) FROM ledger_entry").Scan(&entries))
+	assert.Zero(t, entries)
+}
+
+func TestMoneyCentsSQLite(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite", ":memory:")
+	require.NoError(t, err)
+	db.SetMaxOpenConns(1)
+	defer db.Close()
+
+	m, err := NewMigrator(db)
+	require.NoError(t, err)
+
+	// суммы, сохранённые как REAL, вместе с накопленной ошибкой округления
+	require.NoError(t, m.Up(ctx))
+	require.NoError(t, m.Down(ctx, m.Latest()-11))
+	userID := "6f1c1a52-4a4e-4f43-9d5e-1f6f5f0e8a01"
+	for _, query := range []string{
+		`INSERT INTO "user" (id, login, password) VALUES ('` + userID + `', 'user', '')`,
+		`INSERT INTO balance (user_id, accrual, withdrawal) VALUES ('` + userID + `', 0.1 + 0.2, 729.98)`,
+	} {
+		_, err := db.ExecContext(ctx, query)
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, m.Up(ctx))
+
+	var accrual, withdrawal any
+	require.NoError(t, db.QueryRowContext(ctx, "SELECT accrual, withdrawal FROM balance").Scan(&accrual, &withdrawal))
+	assert.Equal(t, int64(30), accrual)
+	assert.Equal(t, int64(72998), withdrawal)
+
+	// откат возвращает десятичную запись
+	require.NoError(t, m.Down(ctx, m.Latest()-11))
+	require.NoError(t, db.QueryRowContext(ctx, "SELECT accrual, withdrawal FROM balance").Scan(&accrual, &withdrawal))
+	assert.Equal(t, 0.3, accrual)
+	assert.Equal(t, 729.98, withdrawal)
+}
+
+func TestLedgerSequenceSQLite(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite", ":memory:")
+	require.NoError(t, err)
+	db.SetMaxOpenConns(1)
+	defer db.Close()
+
+	m, err := NewMigrator(db)
+	require.NoError(t, err)
+
+	// записи журнала до нумерации: начисление и списание в одну секунду, идентификатор списания меньше
+	require.NoError(t, m.Up(ctx))
+	require.NoError(t, m.Down(ctx, m.Latest()-12))
+	userID := "6f1c1a52-4a4e-4f43-9d5e-1f6f5f0e8a01"
+	for _, query := range []string{
+		`INSERT INTO "user" (id, login, password) VALUES ('` + userID + `', 'user', '')`,
+		`INSERT INTO balance (user_id, accrual, withdrawal, version) VALUES ('` + userID + `', 200, 100, 1)`,
+		`INSERT INTO ledger_entry (id, user_id, kind, reference, created_at)
+		VALUES ('ffffffff-ffff-4fff-bfff-ffffffffffff', '` + userID + `', 'ACCRUAL', '18', '2024-01-02T00:00:00Z'),
+		       ('00000000-0000-4000-8000-000000000001', '` + userID + `', 'WITHDRAWAL', '34', '2024-01-02T00:00:00Z'),
+		       ('0b9d5f0e-1d2c-4c8e-8a0e-3f1e2d4c5b01', '` + userID + `', 'ACCRUAL', '26', '2024-01-01T00:00:00Z')`,
+	} {
+		_, err := db.ExecContext(ctx, query)
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, m.Up(ctx))
+
+	var references []string
+	rows, err := db.QueryContext(ctx, "SELECT reference FROM ledger_entry ORDER BY seq")
+	require.NoError(t, err)
+	for rows.Next() {
+		var reference string
+		require.NoError(t, rows.Scan(&reference))
+		references = append(references, reference)
+	}
+	require.NoError(t, rows.Err())
+	assert.Equal(t, []string{"26", "18", "34"}, references)
+
+	// следующая запись получит номер больше выданных
+	var version int64
+	require.NoError(t, db.QueryRowContext(ctx, "SELECT version FROM balance").Scan(&version))
+	assert.Equal(t, int64(3), version)
+
+	require.NoError(t, m.Down(ctx, 1))
+}
@@ -0,0 +1,4 @@
+DROP TABLE balance_withdrawal;
+DROP TABLE balance_accrual;
+DROP TABLE balance;
+DROP TABLE "user";
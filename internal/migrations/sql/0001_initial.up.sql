@@ -0,0 +1,29 @@
+-- исходная схема; IF NOT EXISTS позволяет принять под управление уже развёрнутые базы
+CREATE TABLE IF NOT EXISTS "user" (
+    id       uuid    not null constraint users_pk primary key,
+    login    varchar not null constraint users_pk_2 unique,
+    password varchar not null
+);
+
+CREATE TABLE IF NOT EXISTS balance (
+    user_id    uuid    not null constraint balance_pk unique constraint balance_users_id_fk references "user",
+    accrual    decimal not null,
+    withdrawal decimal not null
+);
+
+CREATE TABLE IF NOT EXISTS balance_accrual (
+    id         uuid    not null constraint orders_pk primary key,
+    user_id    uuid    not null constraint orders_users_id_fk references "user",
+    number     varchar not null constraint orders_pk_2 unique,
+    status     varchar not null,
+    sum        decimal,
+    created_at timestamp
+);
+
+CREATE TABLE IF NOT EXISTS balance_withdrawal (
+    id         uuid    not null constraint withdrawals_pk primary key,
+    user_id    uuid    not null constraint withdrawals_users_id_fk references "user",
+    number     varchar not null constraint withdrawals_pk_2 unique,
+    sum        decimal not null,
+    created_at timestamp
+);
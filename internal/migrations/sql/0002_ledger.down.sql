@@ -0,0 +1,4 @@
+ALTER TABLE balance DROP COLUMN version;
+DROP TABLE ledger_posting;
+DROP TABLE ledger_entry;
+DROP TABLE ledger_account;
@@ -0,0 +1,26 @@
+CREATE TABLE ledger_account (
+    code       varchar   not null constraint ledger_account_pk primary key,
+    user_id    uuid      constraint ledger_account_users_id_fk references "user",
+    created_at timestamp not null
+);
+
+CREATE TABLE ledger_entry (
+    id         uuid      not null constraint ledger_entry_pk primary key,
+    user_id    uuid      not null constraint ledger_entry_users_id_fk references "user",
+    kind       varchar   not null,
+    reference  varchar   not null,
+    created_at timestamp not null
+);
+
+-- по одному основанию (заказу) допускается только одна запись каждого типа
+CREATE UNIQUE INDEX ledger_entry_kind_reference_uindex ON ledger_entry (kind, reference);
+
+CREATE TABLE ledger_posting (
+    entry_id uuid    not null constraint ledger_posting_entry_id_fk references ledger_entry,
+    account  varchar not null constraint ledger_posting_account_fk references ledger_account,
+    amount   decimal not null,
+    constraint ledger_posting_pk primary key (entry_id, account)
+);
+
+-- версия снимка баланса для оптимистичной блокировки; новые строки получают версию 1
+ALTER TABLE balance ADD COLUMN version bigint not null default 1;
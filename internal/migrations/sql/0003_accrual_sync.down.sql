@@ -0,0 +1,5 @@
+DROP INDEX balance_accrual_status_next_check_at_index;
+ALTER TABLE balance_accrual DROP COLUMN lease_expires_at;
+ALTER TABLE balance_accrual DROP COLUMN lease_owner;
+ALTER TABLE balance_accrual DROP COLUMN next_check_at;
+ALTER TABLE balance_accrual DROP COLUMN attempts;
@@ -0,0 +1,9 @@
+-- состояние опроса системы расчёта начислений
+ALTER TABLE balance_accrual ADD COLUMN attempts integer not null default 0;
+ALTER TABLE balance_accrual ADD COLUMN next_check_at timestamp not null default '1970-01-01 00:00:00';
+
+-- аренда заказа экземпляром сервиса на время его обработки
+ALTER TABLE balance_accrual ADD COLUMN lease_owner varchar;
+ALTER TABLE balance_accrual ADD COLUMN lease_expires_at timestamp;
+
+CREATE INDEX balance_accrual_status_next_check_at_index ON balance_accrual (status, next_check_at);
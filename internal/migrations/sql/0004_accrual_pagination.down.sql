@@ -0,0 +1 @@
+DROP INDEX balance_accrual_user_id_created_at_index;
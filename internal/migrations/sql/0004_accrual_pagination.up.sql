@@ -0,0 +1,2 @@
+-- постраничная выдача заказов пользователя
+CREATE INDEX balance_accrual_user_id_created_at_index ON balance_accrual (user_id, created_at, id);
@@ -0,0 +1 @@
+DROP INDEX balance_withdrawal_user_id_created_at_index;
@@ -0,0 +1,2 @@
+-- постраничная выдача списаний пользователя
+CREATE INDEX balance_withdrawal_user_id_created_at_index ON balance_withdrawal (user_id, created_at, id);
@@ -0,0 +1,15 @@
+-- токены обновления; хранится только хэш, семейство отзывается целиком при повторном использовании
+CREATE TABLE user_refresh_token (
+    id         uuid      not null constraint user_refresh_token_pk primary key,
+    user_id    uuid      not null constraint user_refresh_token_user_id_fk references "user",
+    family_id  uuid      not null,
+    hash       varchar   not null constraint user_refresh_token_hash_key unique,
+    user_agent varchar   not null,
+    ip         varchar   not null,
+    created_at timestamp not null,
+    expires_at timestamp not null,
+    used_at    timestamp,
+    revoked_at timestamp
+);
+
+CREATE INDEX user_refresh_token_family_id_index ON user_refresh_token (family_id);
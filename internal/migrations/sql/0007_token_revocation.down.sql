@@ -0,0 +1,2 @@
+DROP TABLE user_token_generation;
+DROP TABLE user_token_revocation;
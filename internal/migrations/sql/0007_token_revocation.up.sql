@@ -0,0 +1,14 @@
+-- отозванные токены доступа; запись не нужна после истечения срока токена
+CREATE TABLE user_token_revocation (
+    jti        varchar   not null constraint user_token_revocation_pk primary key,
+    expires_at timestamp not null
+);
+
+CREATE INDEX user_token_revocation_expires_at_index ON user_token_revocation (expires_at);
+
+-- поколение токенов пользователя, увеличивается при выходе со всех устройств
+CREATE TABLE user_token_generation (
+    user_id    uuid    not null constraint user_token_generation_pk primary key
+        constraint user_token_generation_user_id_fk references "user",
+    generation integer not null
+);
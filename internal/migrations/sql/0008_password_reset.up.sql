@@ -0,0 +1,9 @@
+-- одноразовые токены сброса пароля; хранится только хэш
+CREATE TABLE user_password_reset (
+    id         uuid      not null constraint user_password_reset_pk primary key,
+    user_id    uuid      not null constraint user_password_reset_user_id_fk references "user",
+    hash       varchar   not null constraint user_password_reset_hash_key unique,
+    created_at timestamp not null,
+    expires_at timestamp not null,
+    used_at    timestamp
+);
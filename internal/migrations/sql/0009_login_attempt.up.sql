@@ -0,0 +1,8 @@
+-- неудачные попытки входа по логину и по адресу клиента, общие для всех экземпляров сервиса
+CREATE TABLE user_login_attempt (
+    key             varchar   not null constraint user_login_attempt_pk primary key,
+    failures        integer   not null,
+    last_failure_at timestamp not null
+);
+
+CREATE INDEX user_login_attempt_last_failure_at_index ON user_login_attempt (last_failure_at);
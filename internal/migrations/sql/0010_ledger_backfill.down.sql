@@ -0,0 +1,12 @@
+-- удаляются только перенесённые записи: их идентификаторы совпадают с исходными строками
+DELETE FROM ledger_posting
+WHERE entry_id IN (SELECT id FROM ledger_entry WHERE kind = 'OPENING')
+   OR entry_id IN (SELECT id FROM balance_accrual)
+   OR entry_id IN (SELECT id FROM balance_withdrawal);
+
+DELETE FROM ledger_entry
+WHERE kind = 'OPENING'
+   OR id IN (SELECT id FROM balance_accrual)
+   OR id IN (SELECT id FROM balance_withdrawal);
+
+DELETE FROM ledger_account WHERE code = 'system:opening';
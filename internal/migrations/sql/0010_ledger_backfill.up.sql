@@ -0,0 +1,71 @@
+-- журнал появился в 0002, а балансы, заказы и списания, созданные раньше, в нём не отражены.
+-- Записи переносятся с идентификаторами исходных строк, расхождение со снимком баланса
+-- закрывается начальной записью OPENING с идентификатором пользователя. Начальные записи
+-- и строки без даты датируются началом эпохи, чтобы предшествовать любому периоду выписки.
+INSERT INTO ledger_account (code, user_id, created_at)
+SELECT 'user:' || user_id, user_id, CURRENT_TIMESTAMP FROM balance
+WHERE true -- без WHERE SQLite не отличает ON CONFLICT от условия соединения
+ON CONFLICT DO NOTHING;
+
+INSERT INTO ledger_account (code, user_id, created_at)
+VALUES ('system:accrual', NULL, CURRENT_TIMESTAMP),
+       ('system:withdrawal', NULL, CURRENT_TIMESTAMP),
+       ('system:opening', NULL, CURRENT_TIMESTAMP)
+ON CONFLICT DO NOTHING;
+
+-- начисления за обработанные заказы
+INSERT INTO ledger_entry (id, user_id, kind, reference, created_at)
+SELECT a.id, a.user_id, 'ACCRUAL', a.number, COALESCE(a.created_at, '1970-01-01T00:00:00Z')
+FROM balance_accrual a
+JOIN balance b ON b.user_id = a.user_id
+WHERE a.status = 'PROCESSED' AND a.sum > 0
+ON CONFLICT DO NOTHING;
+
+INSERT INTO ledger_posting (entry_id, account, amount)
+SELECT a.id, 'system:accrual', -a.sum
+FROM balance_accrual a
+JOIN ledger_entry e ON e.id = a.id;
+
+INSERT INTO ledger_posting (entry_id, account, amount)
+SELECT a.id, 'user:' || a.user_id, a.sum
+FROM balance_accrual a
+JOIN ledger_entry e ON e.id = a.id;
+
+-- списания
+INSERT INTO ledger_entry (id, user_id, kind, reference, created_at)
+SELECT w.id, w.user_id, 'WITHDRAWAL', w.number, COALESCE(w.created_at, '1970-01-01T00:00:00Z')
+FROM balance_withdrawal w
+JOIN balance b ON b.user_id = w.user_id
+WHERE w.sum > 0
+ON CONFLICT DO NOTHING;
+
+INSERT INTO ledger_posting (entry_id, account, amount)
+SELECT w.id, 'user:' || w.user_id, -w.sum
+FROM balance_withdrawal w
+JOIN ledger_entry e ON e.id = w.id;
+
+INSERT INTO ledger_posting (entry_id, account, amount)
+SELECT w.id, 'system:withdrawal', w.sum
+FROM balance_withdrawal w
+JOIN ledger_entry e ON e.id = w.id;
+
+-- остаток снимка, не подтверждённый журналом
+CREATE TEMPORARY TABLE ledger_opening AS
+SELECT b.user_id, round(b.accrual - b.withdrawal - COALESCE(p.amount, 0), 2) AS amount
+FROM balance b
+LEFT JOIN (
+    SELECT account, sum(amount) AS amount FROM ledger_posting GROUP BY account
+) p ON p.account = 'user:' || b.user_id;
+
+INSERT INTO ledger_entry (id, user_id, kind, reference, created_at)
+SELECT user_id, user_id, 'OPENING', 'opening:' || user_id, '1970-01-01T00:00:00Z'
+FROM ledger_opening
+WHERE amount <> 0;
+
+INSERT INTO ledger_posting (entry_id, account, amount)
+SELECT user_id, 'system:opening', -amount FROM ledger_opening WHERE amount <> 0;
+
+INSERT INTO ledger_posting (entry_id, account, amount)
+SELECT user_id, 'user:' || user_id, amount FROM ledger_opening WHERE amount <> 0;
+
+DROP TABLE ledger_opening;
@@ -0,0 +1,2 @@
+-- исходные версии не восстанавливаются: проверка не зависит от конкретного значения
+SELECT 1;
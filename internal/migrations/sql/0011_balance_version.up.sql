@@ -0,0 +1,3 @@
+-- до исправления 0002 снимки получали версию 0, а версия 0 означала проводку без проверки.
+-- Приводим такие строки к версии, которую присваивает новая строка баланса.
+UPDATE balance SET version = 1 WHERE version = 0;
@@ -0,0 +1,24 @@
+ALTER TABLE balance ADD COLUMN accrual_decimal decimal not null default 0;
+UPDATE balance SET accrual_decimal = accrual / 100.0;
+ALTER TABLE balance DROP COLUMN accrual;
+ALTER TABLE balance RENAME COLUMN accrual_decimal TO accrual;
+
+ALTER TABLE balance ADD COLUMN withdrawal_decimal decimal not null default 0;
+UPDATE balance SET withdrawal_decimal = withdrawal / 100.0;
+ALTER TABLE balance DROP COLUMN withdrawal;
+ALTER TABLE balance RENAME COLUMN withdrawal_decimal TO withdrawal;
+
+ALTER TABLE balance_accrual ADD COLUMN sum_decimal decimal;
+UPDATE balance_accrual SET sum_decimal = sum / 100.0 WHERE sum IS NOT NULL;
+ALTER TABLE balance_accrual DROP COLUMN sum;
+ALTER TABLE balance_accrual RENAME COLUMN sum_decimal TO sum;
+
+ALTER TABLE balance_withdrawal ADD COLUMN sum_decimal decimal not null default 0;
+UPDATE balance_withdrawal SET sum_decimal = sum / 100.0;
+ALTER TABLE balance_withdrawal DROP COLUMN sum;
+ALTER TABLE balance_withdrawal RENAME COLUMN sum_decimal TO sum;
+
+ALTER TABLE ledger_posting ADD COLUMN amount_decimal decimal not null default 0;
+UPDATE ledger_posting SET amount_decimal = amount / 100.0;
+ALTER TABLE ledger_posting DROP COLUMN amount;
+ALTER TABLE ledger_posting RENAME COLUMN amount_decimal TO amount;
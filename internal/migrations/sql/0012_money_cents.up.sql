@@ -0,0 +1,28 @@
+-- суммы хранятся целыми копейками, как model.Money: в SQLite колонка decimal хранит REAL,
+-- и накопленные ошибки округления проявлялись в суммах. Колонка пересоздаётся, потому что
+-- SQLite не умеет менять тип существующей колонки.
+
+ALTER TABLE balance ADD COLUMN accrual_cents bigint not null default 0;
+UPDATE balance SET accrual_cents = CAST(round(accrual * 100) AS bigint);
+ALTER TABLE balance DROP COLUMN accrual;
+ALTER TABLE balance RENAME COLUMN accrual_cents TO accrual;
+
+ALTER TABLE balance ADD COLUMN withdrawal_cents bigint not null default 0;
+UPDATE balance SET withdrawal_cents = CAST(round(withdrawal * 100) AS bigint);
+ALTER TABLE balance DROP COLUMN withdrawal;
+ALTER TABLE balance RENAME COLUMN withdrawal_cents TO withdrawal;
+
+ALTER TABLE balance_accrual ADD COLUMN sum_cents bigint;
+UPDATE balance_accrual SET sum_cents = CAST(round(sum * 100) AS bigint) WHERE sum IS NOT NULL;
+ALTER TABLE balance_accrual DROP COLUMN sum;
+ALTER TABLE balance_accrual RENAME COLUMN sum_cents TO sum;
+
+ALTER TABLE balance_withdrawal ADD COLUMN sum_cents bigint not null default 0;
+UPDATE balance_withdrawal SET sum_cents = CAST(round(sum * 100) AS bigint);
+ALTER TABLE balance_withdrawal DROP COLUMN sum;
+ALTER TABLE balance_withdrawal RENAME COLUMN sum_cents TO sum;
+
+ALTER TABLE ledger_posting ADD COLUMN amount_cents bigint not null default 0;
+UPDATE ledger_posting SET amount_cents = CAST(round(amount * 100) AS bigint);
+ALTER TABLE ledger_posting DROP COLUMN amount;
+ALTER TABLE ledger_posting RENAME COLUMN amount_cents TO amount;
@@ -0,0 +1,3 @@
+-- версии снимков не восстанавливаются: проверка не зависит от конкретного значения
+DROP INDEX ledger_entry_user_id_seq_uindex;
+ALTER TABLE ledger_entry DROP COLUMN seq;
@@ -0,0 +1,20 @@
+-- порядковый номер записи среди записей пользователя. Новая запись получает версию снимка баланса
+-- после проводки: снимок меняется под блокировкой строки, поэтому номера идут в том порядке,
+-- в каком записи применялись к балансу, даже если сделаны в одну секунду.
+ALTER TABLE ledger_entry ADD COLUMN seq bigint;
+
+-- прежние записи нумеруются по времени, а в пределах одной секунды списания идут
+-- после начислений, чтобы остаток в выписке не уходил в минус
+UPDATE ledger_entry SET seq = numbered.seq
+FROM (
+    SELECT id, row_number() OVER (PARTITION BY user_id ORDER BY created_at, kind = 'WITHDRAWAL', id) AS seq
+    FROM ledger_entry
+) numbered
+WHERE ledger_entry.id = numbered.id;
+
+-- следующие номера берутся из версии снимка, поэтому она не должна быть меньше уже выданных
+UPDATE balance SET version = numbered.entries
+FROM (SELECT user_id, count(*) AS entries FROM ledger_entry GROUP BY user_id) numbered
+WHERE balance.user_id = numbered.user_id AND balance.version < numbered.entries;
+
+CREATE UNIQUE INDEX ledger_entry_user_id_seq_uindex ON ledger_entry (user_id, seq);
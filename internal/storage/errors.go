@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5/pgconn"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// ErrNotFound возвращается, когда запрошенной записи нет в хранилище
+var ErrNotFound = errors.New("запись не найдена")
+
+// ErrDuplicate возвращается при попытке повторно сохранить уникальную запись
+var ErrDuplicate = errors.New("запись уже существует")
+
+// ErrConflict возвращается, когда запись изменилась с момента её чтения
+var ErrConflict = errors.New("данные были изменены параллельным запросом")
+
+// код ошибки PostgreSQL unique_violation
+const pgUniqueViolation = "23505"
+
+// Translate заменяет ошибки драйверов баз данных ошибками хранилища,
+// исходная ошибка нарушения уникальности сохраняется для журнала
+func Translate(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, sql.ErrNoRows):
+		return ErrNotFound
+	case isUniqueViolation(err):
+		return fmt.Errorf("%w: %w", ErrDuplicate, err)
+	}
+
+	return err
+}
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == pgUniqueViolation
+	}
+
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE ||
+			sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY
+	}
+
+	return false
+}
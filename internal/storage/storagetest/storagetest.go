@@ -0,0 +1,1205 @@
+// Package storagetest содержит общий набор тестов, которому должна соответствовать
+// любая реализация хранилищ: PostgreSQL, SQLite или хранилище в памяти.
+package storagetest
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yury-kuznetsov/gofermart/internal/balance/model"
+	balanceService "github.com/yury-kuznetsov/gofermart/internal/balance/service"
+	"github.com/yury-kuznetsov/gofermart/internal/storage"
+	userModel "github.com/yury-kuznetsov/gofermart/internal/user/model"
+	userService "github.com/yury-kuznetsov/gofermart/internal/user/service"
+	"slices"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// количество параллельных запросов в тестах конкурентной записи
+const concurrency = 10
+
+// LoginAttemptRepository хранит и попытки входа, и счётчики запросов сброса пароля
+type LoginAttemptRepository interface {
+	userService.LoginAttemptRepository
+	userService.ResetRequestRepository
+}
+
+// Backend - хранилища одной реализации
+type Backend struct {
+	User          userService.UserRepository
+	RefreshToken  userService.RefreshTokenRepository
+	Revocation    userService.RevocationRepository
+	PasswordReset userService.PasswordResetRepository
+	LoginAttempt  LoginAttemptRepository
+	Balance       balanceService.BalanceRepository
+	Ledger        balanceService.LedgerRepository
+	Accrual       balanceService.AccrualRepository
+	Withdrawal    balanceService.WithdrawalsRepository
+	Statement     balanceService.StatementRepository
+}
+
+// Run проверяет реализацию хранилищ. newBackend вызывается перед каждым тестом
+// и должен возвращать хранилища без данных.
+func Run(t *testing.T, newBackend func(t *testing.T) Backend) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, b Backend)
+	}{
+		{"UserCreateAndFind", testUserCreateAndFind},
+		{"UserNotFound", testUserNotFound},
+		{"UserUniqueLogin", testUserUniqueLogin},
+		{"UserConcurrentCreate", testUserConcurrentCreate},
+		{"UserFindByID", testUserFindByID},
+		{"UserUpdatePassword", testUserUpdatePassword},
+		{"RefreshTokenCreateAndFind", testRefreshTokenCreateAndFind},
+		{"RefreshTokenLocalZone", testRefreshTokenLocalZone},
+		{"RefreshTokenNotFound", testRefreshTokenNotFound},
+		{"RefreshTokenUniqueHash", testRefreshTokenUniqueHash},
+		{"RefreshTokenConcurrentMarkUsed", testRefreshTokenConcurrentMarkUsed},
+		{"RefreshTokenRevokeFamily", testRefreshTokenRevokeFamily},
+		{"RefreshTokenRevokeUser", testRefreshTokenRevokeUser},
+		{"RevocationToken", testRevocationToken},
+		{"RevocationUser", testRevocationUser},
+		{"RevocationConcurrentUser", testRevocationConcurrentUser},
+		{"PasswordResetCreateAndFind", testPasswordResetCreateAndFind},
+		{"PasswordResetConcurrentMarkUsed", testPasswordResetConcurrentMarkUsed},
+		{"PasswordResetRevokeUser", testPasswordResetRevokeUser},
+		{"PasswordResetLocalZone", testPasswordResetLocalZone},
+		{"LoginAttemptAddFailure", testLoginAttemptAddFailure},
+		{"LoginAttemptConcurrentFailure", testLoginAttemptConcurrentFailure},
+		{"LoginAttemptExpire", testLoginAttemptExpire},
+		{"LoginAttemptReserve", testLoginAttemptReserve},
+		{"LoginAttemptConcurrentReserve", testLoginAttemptConcurrentReserve},
+		{"LoginAttemptLocalZone", testLoginAttemptLocalZone},
+		{"AccrualSaveAndFind", testAccrualSaveAndFind},
+		{"AccrualNotFound", testAccrualNotFound},
+		{"AccrualCreate", testAccrualCreate},
+		{"AccrualConcurrentCreate", testAccrualConcurrentCreate},
+		{"AccrualUniqueNumber", testAccrualUniqueNumber},
+		{"AccrualOrderByCreatedAt", testAccrualOrderByCreatedAt},
+		{"AccrualConcurrentSave", testAccrualConcurrentSave},
+		{"AccrualFindPage", testAccrualFindPage},
+		{"AccrualClaimForSync", testAccrualClaimForSync},
+		{"BalanceEmpty", testBalanceEmpty},
+		{"LedgerPost", testLedgerPost},
+		{"LedgerConcurrentPost", testLedgerConcurrentPost},
+		{"WithdrawalCreateAndFind", testWithdrawalCreateAndFind},
+		{"WithdrawalUniqueNumber", testWithdrawalUniqueNumber},
+		{"WithdrawalOrderByCreatedAt", testWithdrawalOrderByCreatedAt},
+		{"WithdrawalFindPage", testWithdrawalFindPage},
+		{"WithdrawalTotal", testWithdrawalTotal},
+		{"Statement", testStatement},
+		{"StatementSameSecond", testStatementSameSecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newBackend(t))
+		})
+	}
+}
+
+func testUserCreateAndFind(t *testing.T, b Backend) {
+	ctx := context.Background()
+	id, err := b.User.Create(ctx, "user", "hash")
+	require.NoError(t, err)
+	assert.NotEqual(t, uuid.Nil, id)
+
+	user, err := b.User.FindByLogin(ctx, "user")
+	require.NoError(t, err)
+	assert.Equal(t, id, user.ID)
+	assert.Equal(t, "user", user.Login)
+	assert.Equal(t, "hash", user.Password)
+}
+
+func testUserNotFound(t *testing.T, b Backend) {
+	user, err := b.User.FindByLogin(context.Background(), "missing")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	assert.Equal(t, uuid.Nil, user.ID)
+}
+
+func testUserUniqueLogin(t *testing.T, b Backend) {
+	ctx := context.Background()
+	_, err := b.User.Create(ctx, "user", "hash")
+	require.NoError(t, err)
+
+	id, err := b.User.Create(ctx, "user", "another")
+	assert.ErrorIs(t, err, storage.ErrDuplicate)
+	assert.Equal(t, uuid.Nil, id)
+
+	// первая запись не изменилась
+	user, err := b.User.FindByLogin(ctx, "user")
+	require.NoError(t, err)
+	assert.Equal(t, "hash", user.Password)
+}
+
+func testUserConcurrentCreate(t *testing.T, b Backend) {
+	created := parallel(func(i int) error {
+		_, err := b.User.Create(context.Background(), "user", fmt.Sprint(i))
+		return err
+	})
+	assert.Equal(t, 1, created)
+}
+
+func testUserFindByID(t *testing.T, b Backend) {
+	ctx := context.Background()
+	id := newUser(t, b, "user")
+
+	user, err := b.User.FindByID(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, "user", user.Login)
+
+	_, err = b.User.FindByID(ctx, uuid.New())
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func testUserUpdatePassword(t *testing.T, b Backend) {
+	ctx := context.Background()
+	id := newUser(t, b, "user")
+	other := newUser(t, b, "other")
+
+	require.NoError(t, b.User.UpdatePassword(ctx, id, "new"))
+
+	user, err := b.User.FindByLogin(ctx, "user")
+	require.NoError(t, err)
+	assert.Equal(t, "new", user.Password)
+
+	// пароль другого пользователя не изменился
+	user, err = b.User.FindByID(ctx, other)
+	require.NoError(t, err)
+	assert.Equal(t, "hash", user.Password)
+
+	assert.ErrorIs(t, b.User.UpdatePassword(ctx, uuid.New(), "new"), storage.ErrNotFound)
+}
+
+func testRefreshTokenCreateAndFind(t *testing.T, b Backend) {
+	ctx := context.Background()
+	token := newRefreshToken(newUser(t, b, "user"), uuid.New(), "hash")
+	require.NoError(t, b.RefreshToken.Create(ctx, token))
+
+	found, err := b.RefreshToken.FindByHash(ctx, "hash")
+	require.NoError(t, err)
+	assert.Equal(t, token.ID, found.ID)
+	assert.Equal(t, token.UserID, found.UserID)
+	assert.Equal(t, token.FamilyID, found.FamilyID)
+	assert.Equal(t, token.Device, found.Device)
+	assert.True(t, token.CreatedAt.Equal(found.CreatedAt), "created_at: %v != %v", token.CreatedAt, found.CreatedAt)
+	assert.True(t, token.ExpiresAt.Equal(found.ExpiresAt), "expires_at: %v != %v", token.ExpiresAt, found.ExpiresAt)
+	assert.Nil(t, found.UsedAt)
+	assert.Nil(t, found.RevokedAt)
+}
+
+func testRefreshTokenLocalZone(t *testing.T, b Backend) {
+	ctx := context.Background()
+	userID := newUser(t, b, "user")
+
+	// срок действия токена не зависит от пояса сервера
+	for i, offset := range []time.Duration{3 * time.Hour, -5 * time.Hour} {
+		withLocalZone(t, offset)
+		hash := fmt.Sprint("hash", i)
+		token := newRefreshToken(userID, uuid.New(), hash)
+		require.NoError(t, b.RefreshToken.Create(ctx, token))
+
+		now := time.Now().Truncate(time.Second)
+		require.NoError(t, b.RefreshToken.MarkUsed(ctx, token.ID, now))
+
+		found, err := b.RefreshToken.FindByHash(ctx, hash)
+		require.NoError(t, err)
+		assert.True(t, token.CreatedAt.Equal(found.CreatedAt), "created_at: %v != %v", token.CreatedAt, found.CreatedAt)
+		assert.True(t, token.ExpiresAt.Equal(found.ExpiresAt), "expires_at: %v != %v", token.ExpiresAt, found.ExpiresAt)
+		if assert.NotNil(t, found.UsedAt) {
+			assert.True(t, now.Equal(*found.UsedAt), "used_at: %v != %v", now, *found.UsedAt)
+		}
+	}
+}
+
+func testRefreshTokenNotFound(t *testing.T, b Backend) {
+	_, err := b.RefreshToken.FindByHash(context.Background(), "missing")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func testRefreshTokenUniqueHash(t *testing.T, b Backend) {
+	ctx := context.Background()
+	userID := newUser(t, b, "user")
+	require.NoError(t, b.RefreshToken.Create(ctx, newRefreshToken(userID, uuid.New(), "hash")))
+
+	err := b.RefreshToken.Create(ctx, newRefreshToken(userID, uuid.New(), "hash"))
+	assert.ErrorIs(t, err, storage.ErrDuplicate)
+}
+
+func testRefreshTokenConcurrentMarkUsed(t *testing.T, b Backend) {
+	ctx := context.Background()
+	token := newRefreshToken(newUser(t, b, "user"), uuid.New(), "hash")
+	require.NoError(t, b.RefreshToken.Create(ctx, token))
+
+	// обменять токен удаётся только одному запросу
+	now := time.Now().Truncate(time.Second)
+	used := parallel(func(int) error {
+		return b.RefreshToken.MarkUsed(ctx, token.ID, now)
+	})
+	assert.Equal(t, 1, used)
+
+	found, err := b.RefreshToken.FindByHash(ctx, "hash")
+	require.NoError(t, err)
+	require.NotNil(t, found.UsedAt)
+	assert.True(t, now.Equal(*found.UsedAt), "used_at: %v != %v", now, *found.UsedAt)
+
+	assert.ErrorIs(t, b.RefreshToken.MarkUsed(ctx, token.ID, now), storage.ErrConflict)
+}
+
+func testRefreshTokenRevokeFamily(t *testing.T, b Backend) {
+	ctx := context.Background()
+	userID := newUser(t, b, "user")
+	family := uuid.New()
+	first := newRefreshToken(userID, family, "first")
+	second := newRefreshToken(userID, family, "second")
+	other := newRefreshToken(userID, uuid.New(), "other")
+	for _, token := range []userModel.RefreshToken{first, second, other} {
+		require.NoError(t, b.RefreshToken.Create(ctx, token))
+	}
+
+	require.NoError(t, b.RefreshToken.RevokeFamily(ctx, family, time.Now()))
+
+	for hash, revoked := range map[string]bool{"first": true, "second": true, "other": false} {
+		found, err := b.RefreshToken.FindByHash(ctx, hash)
+		require.NoError(t, err)
+		assert.Equal(t, revoked, found.RevokedAt != nil, hash)
+	}
+
+	// отозванный токен нельзя обменять
+	assert.ErrorIs(t, b.RefreshToken.MarkUsed(ctx, second.ID, time.Now()), storage.ErrConflict)
+}
+
+func testRefreshTokenRevokeUser(t *testing.T, b Backend) {
+	ctx := context.Background()
+	userID := newUser(t, b, "user")
+	require.NoError(t, b.RefreshToken.Create(ctx, newRefreshToken(userID, uuid.New(), "first")))
+	require.NoError(t, b.RefreshToken.Create(ctx, newRefreshToken(userID, uuid.New(), "second")))
+	require.NoError(t, b.RefreshToken.Create(ctx, newRefreshToken(newUser(t, b, "other"), uuid.New(), "other")))
+
+	require.NoError(t, b.RefreshToken.RevokeUser(ctx, userID, time.Now()))
+
+	for hash, revoked := range map[string]bool{"first": true, "second": true, "other": false} {
+		found, err := b.RefreshToken.FindByHash(ctx, hash)
+		require.NoError(t, err)
+		assert.Equal(t, revoked, found.RevokedAt != nil, hash)
+	}
+}
+
+func testRevocationToken(t *testing.T, b Backend) {
+	ctx := context.Background()
+	userID := newUser(t, b, "user")
+
+	revoked, err := b.Revocation.IsRevoked(ctx, "jti", userID, 0)
+	require.NoError(t, err)
+	assert.False(t, revoked)
+
+	// повторный отзыв того же токена не ошибка
+	require.NoError(t, b.Revocation.RevokeToken(ctx, "jti", time.Now().Add(time.Hour)))
+	require.NoError(t, b.Revocation.RevokeToken(ctx, "jti", time.Now().Add(time.Hour)))
+
+	revoked, err = b.Revocation.IsRevoked(ctx, "jti", userID, 0)
+	require.NoError(t, err)
+	assert.True(t, revoked)
+
+	revoked, err = b.Revocation.IsRevoked(ctx, "another", userID, 0)
+	require.NoError(t, err)
+	assert.False(t, revoked)
+}
+
+func testRevocationUser(t *testing.T, b Backend) {
+	ctx := context.Background()
+	userID := newUser(t, b, "user")
+	other := newUser(t, b, "other")
+
+	generation, err := b.Revocation.Generation(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, 0, generation)
+
+	require.NoError(t, b.Revocation.RevokeUser(ctx, userID))
+	require.NoError(t, b.Revocation.RevokeUser(ctx, userID))
+
+	generation, err = b.Revocation.Generation(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, 2, generation)
+
+	// токены прежних поколений отозваны, текущего - нет
+	for gen, expected := range map[int]bool{0: true, 1: true, 2: false} {
+		revoked, err := b.Revocation.IsRevoked(ctx, "jti", userID, gen)
+		require.NoError(t, err)
+		assert.Equal(t, expected, revoked, gen)
+	}
+
+	// другие пользователи не затронуты
+	revoked, err := b.Revocation.IsRevoked(ctx, "jti", other, 0)
+	require.NoError(t, err)
+	assert.False(t, revoked)
+}
+
+func testRevocationConcurrentUser(t *testing.T, b Backend) {
+	ctx := context.Background()
+	userID := newUser(t, b, "user")
+
+	// каждый выход со всех устройств увеличивает поколение
+	revoked := parallel(func(int) error {
+		return b.Revocation.RevokeUser(ctx, userID)
+	})
+	assert.Equal(t, concurrency, revoked)
+
+	generation, err := b.Revocation.Generation(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, concurrency, generation)
+}
+
+func testPasswordResetCreateAndFind(t *testing.T, b Backend) {
+	ctx := context.Background()
+	reset := newPasswordReset(newUser(t, b, "user"), "hash")
+	require.NoError(t, b.PasswordReset.Create(ctx, reset))
+
+	found, err := b.PasswordReset.FindByHash(ctx, "hash")
+	require.NoError(t, err)
+	assert.Equal(t, reset.ID, found.ID)
+	assert.Equal(t, reset.UserID, found.UserID)
+	assert.True(t, reset.ExpiresAt.Equal(found.ExpiresAt), "expires_at: %v != %v", reset.ExpiresAt, found.ExpiresAt)
+	assert.Nil(t, found.UsedAt)
+
+	_, err = b.PasswordReset.FindByHash(ctx, "missing")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+
+	err = b.PasswordReset.Create(ctx, newPasswordReset(reset.UserID, "hash"))
+	assert.ErrorIs(t, err, storage.ErrDuplicate)
+}
+
+func testPasswordResetConcurrentMarkUsed(t *testing.T, b Backend) {
+	ctx := context.Background()
+	reset := newPasswordReset(newUser(t, b, "user"), "hash")
+	require.NoError(t, b.PasswordReset.Create(ctx, reset))
+
+	// воспользоваться токеном удаётся только одному запросу
+	used := parallel(func(int) error {
+		return b.PasswordReset.MarkUsed(ctx, reset.ID, time.Now())
+	})
+	assert.Equal(t, 1, used)
+
+	found, err := b.PasswordReset.FindByHash(ctx, "hash")
+	require.NoError(t, err)
+	assert.NotNil(t, found.UsedAt)
+}
+
+func testPasswordResetRevokeUser(t *testing.T, b Backend) {
+	ctx := context.Background()
+	userID := newUser(t, b, "user")
+	other := newUser(t, b, "other")
+	require.NoError(t, b.PasswordReset.Create(ctx, newPasswordReset(userID, "first")))
+	require.NoError(t, b.PasswordReset.Create(ctx, newPasswordReset(userID, "second")))
+	require.NoError(t, b.PasswordReset.Create(ctx, newPasswordReset(other, "other")))
+
+	require.NoError(t, b.PasswordReset.RevokeUser(ctx, userID, time.Now()))
+
+	for _, hash := range []string{"first", "second"} {
+		found, err := b.PasswordReset.FindByHash(ctx, hash)
+		require.NoError(t, err)
+		assert.NotNil(t, found.UsedAt, hash)
+	}
+
+	// токены других пользователей не затронуты
+	found, err := b.PasswordReset.FindByHash(ctx, "other")
+	require.NoError(t, err)
+	assert.Nil(t, found.UsedAt)
+}
+
+func testPasswordResetLocalZone(t *testing.T, b Backend) {
+	ctx := context.Background()
+	userID := newUser(t, b, "user")
+
+	// срок действия токена не зависит от пояса сервера
+	for i, offset := range []time.Duration{3 * time.Hour, -5 * time.Hour} {
+		withLocalZone(t, offset)
+		hash := fmt.Sprint("hash", i)
+		reset := newPasswordReset(userID, hash)
+		require.NoError(t, b.PasswordReset.Create(ctx, reset))
+
+		found, err := b.PasswordReset.FindByHash(ctx, hash)
+		require.NoError(t, err)
+		assert.True(t, reset.ExpiresAt.Equal(found.ExpiresAt), "expires_at: %v != %v", reset.ExpiresAt, found.ExpiresAt)
+		assert.True(t, found.Active(time.Now()))
+
+		now := time.Now().Truncate(time.Second)
+		require.NoError(t, b.PasswordReset.MarkUsed(ctx, reset.ID, now))
+		found, err = b.PasswordReset.FindByHash(ctx, hash)
+		require.NoError(t, err)
+		if assert.NotNil(t, found.UsedAt) {
+			assert.True(t, now.Equal(*found.UsedAt), "used_at: %v != %v", now, *found.UsedAt)
+		}
+	}
+}
+
+func testLoginAttemptAddFailure(t *testing.T, b Backend) {
+	ctx := context.Background()
+	now := time.Now().Truncate(time.Second)
+
+	_, err := b.LoginAttempt.Find(ctx, "login:user")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+
+	for i := 1; i <= 3; i++ {
+		failures, err := b.LoginAttempt.AddFailure(ctx, "login:user", now, now.Add(-time.Hour))
+		require.NoError(t, err)
+		assert.Equal(t, i, failures)
+	}
+	_, err = b.LoginAttempt.AddFailure(ctx, "ip:127.0.0.1", now, now.Add(-time.Hour))
+	require.NoError(t, err)
+
+	attempts, err := b.LoginAttempt.Find(ctx, "login:user")
+	require.NoError(t, err)
+	assert.Equal(t, 3, attempts.Failures)
+	assert.True(t, now.Equal(attempts.LastFailureAt), "last_failure_at: %v != %v", now, attempts.LastFailureAt)
+
+	// удаление не затрагивает другие ключи
+	require.NoError(t, b.LoginAttempt.Delete(ctx, "login:user"))
+	_, err = b.LoginAttempt.Find(ctx, "login:user")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	_, err = b.LoginAttempt.Find(ctx, "ip:127.0.0.1")
+	assert.NoError(t, err)
+}
+
+func testLoginAttemptConcurrentFailure(t *testing.T, b Backend) {
+	ctx := context.Background()
+	now := time.Now()
+
+	// параллельные неудачные попытки не теряются
+	failed := parallel(func(int) error {
+		_, err := b.LoginAttempt.AddFailure(ctx, "login:user", now, now.Add(-time.Hour))
+		return err
+	})
+	assert.Equal(t, concurrency, failed)
+
+	attempts, err := b.LoginAttempt.Find(ctx, "login:user")
+	require.NoError(t, err)
+	assert.Equal(t, concurrency, attempts.Failures)
+}
+
+func testLoginAttemptExpire(t *testing.T, b Backend) {
+	ctx := context.Background()
+	old := time.Now().Add(-2 * time.Hour)
+	now := time.Now()
+
+	for i := 0; i < 3; i++ {
+		_, err := b.LoginAttempt.AddFailure(ctx, "login:user", old, old.Add(-time.Hour))
+		require.NoError(t, err)
+	}
+	_, err := b.LoginAttempt.AddFailure(ctx, "login:other", old, old.Add(-time.Hour))
+	require.NoError(t, err)
+
+	// давние попытки забываются
+	failures, err := b.LoginAttempt.AddFailure(ctx, "login:user", now, now.Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 1, failures)
+
+	_, err = b.LoginAttempt.Find(ctx, "login:other")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func testLoginAttemptReserve(t *testing.T, b Backend) {
+	ctx := context.Background()
+	now := time.Now().Truncate(time.Second)
+	attempts := userModel.LoginAttempts{Key: "login:user", Failures: 1, LastFailureAt: now}
+
+	// первая попытка создаёт запись, повторно по тому же значению счётчика не проходит
+	require.NoError(t, b.LoginAttempt.Reserve(ctx, 0, attempts, now.Add(-time.Hour)))
+	assert.ErrorIs(t, b.LoginAttempt.Reserve(ctx, 0, attempts, now.Add(-time.Hour)), storage.ErrConflict)
+
+	attempts.Failures = 2
+	require.NoError(t, b.LoginAttempt.Reserve(ctx, 1, attempts, now.Add(-time.Hour)))
+	assert.ErrorIs(t, b.LoginAttempt.Reserve(ctx, 1, attempts, now.Add(-time.Hour)), storage.ErrConflict)
+
+	found, err := b.LoginAttempt.Find(ctx, "login:user")
+	require.NoError(t, err)
+	assert.Equal(t, 2, found.Failures)
+	assert.True(t, now.Equal(found.LastFailureAt), "last_failure_at: %v != %v", now, found.LastFailureAt)
+
+	// снятые попытки освобождают счётчик, в том числе до нуля
+	require.NoError(t, b.LoginAttempt.Release(ctx, "login:user"))
+	require.NoError(t, b.LoginAttempt.Release(ctx, "login:user"))
+	require.NoError(t, b.LoginAttempt.Release(ctx, "login:user"))
+	require.NoError(t, b.LoginAttempt.Release(ctx, "login:missing"))
+	found, err = b.LoginAttempt.Find(ctx, "login:user")
+	require.NoError(t, err)
+	assert.Equal(t, 0, found.Failures)
+
+	attempts.Failures = 1
+	require.NoError(t, b.LoginAttempt.Reserve(ctx, 0, attempts, now.Add(-time.Hour)))
+}
+
+func testLoginAttemptConcurrentReserve(t *testing.T, b Backend) {
+	ctx := context.Background()
+	now := time.Now()
+
+	// по одному значению счётчика попытку учитывает только один запрос
+	reserved := parallel(func(int) error {
+		next := userModel.LoginAttempts{Key: "login:user", Failures: 1, LastFailureAt: now}
+		return b.LoginAttempt.Reserve(ctx, 0, next, now.Add(-time.Hour))
+	})
+	assert.Equal(t, 1, reserved)
+
+	reserved = parallel(func(int) error {
+		next := userModel.LoginAttempts{Key: "login:user", Failures: 2, LastFailureAt: now}
+		return b.LoginAttempt.Reserve(ctx, 1, next, now.Add(-time.Hour))
+	})
+	assert.Equal(t, 1, reserved)
+}
+
+func testLoginAttemptLocalZone(t *testing.T, b Backend) {
+	ctx := context.Background()
+
+	// время попытки не сдвигается на смещение пояса сервера ни к востоку, ни к западу от UTC
+	for i, offset := range []time.Duration{3 * time.Hour, -5 * time.Hour} {
+		withLocalZone(t, offset)
+		now := time.Now().Truncate(time.Second)
+		key := fmt.Sprint("login:user", i)
+
+		next := userModel.LoginAttempts{Key: key, Failures: 1, LastFailureAt: now}
+		require.NoError(t, b.LoginAttempt.Reserve(ctx, 0, next, now.Add(-time.Hour)))
+		found, err := b.LoginAttempt.Find(ctx, key)
+		require.NoError(t, err)
+		assert.True(t, now.Equal(found.LastFailureAt), "last_failure_at: %v != %v", now, found.LastFailureAt)
+
+		// свежая попытка не считается давней
+		failures, err := b.LoginAttempt.AddFailure(ctx, key, now, now.Add(-time.Hour))
+		require.NoError(t, err)
+		assert.Equal(t, 2, failures)
+	}
+}
+
+func testAccrualSaveAndFind(t *testing.T, b Backend) {
+	ctx := context.Background()
+	userID := newUser(t, b, "user")
+	accrual := newAccrual(userID, "1001", time.Now())
+	require.NoError(t, b.Accrual.Save(ctx, accrual))
+
+	found, err := b.Accrual.FindByNumber(ctx, "1001")
+	require.NoError(t, err)
+	assertAccrual(t, accrual, found)
+
+	// повторное сохранение обновляет запись
+	sum := model.Money(72998)
+	accrual.Status = model.StatusProcessed
+	accrual.Sum = &sum
+	accrual.Attempts = 3
+	accrual.NextCheckAt = accrual.NextCheckAt.Add(time.Minute)
+	require.NoError(t, b.Accrual.Save(ctx, accrual))
+
+	found, err = b.Accrual.FindByNumber(ctx, "1001")
+	require.NoError(t, err)
+	assertAccrual(t, accrual, found)
+
+	accruals, err := b.Accrual.FindByUser(ctx, userID)
+	require.NoError(t, err)
+	assert.Len(t, accruals, 1)
+}
+
+func testAccrualNotFound(t *testing.T, b Backend) {
+	accrual, err := b.Accrual.FindByNumber(context.Background(), "1001")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	assert.Equal(t, uuid.Nil, accrual.ID)
+}
+
+func testAccrualCreate(t *testing.T, b Backend) {
+	ctx := context.Background()
+	userID := newUser(t, b, "user")
+	anotherID := newUser(t, b, "another")
+
+	accrual := newAccrual(userID, "1001", time.Now())
+	stored, err := b.Accrual.Create(ctx, accrual)
+	require.NoError(t, err)
+	assertAccrual(t, accrual, stored)
+
+	// повторная загрузка номера возвращает существующий заказ без изменений
+	stored, err = b.Accrual.Create(ctx, newAccrual(anotherID, "1001", time.Now().Add(time.Hour)))
+	require.NoError(t, err)
+	assertAccrual(t, accrual, stored)
+
+	found, err := b.Accrual.FindByNumber(ctx, "1001")
+	require.NoError(t, err)
+	assertAccrual(t, accrual, found)
+}
+
+func testAccrualConcurrentCreate(t *testing.T, b Backend) {
+	ctx := context.Background()
+	userID := newUser(t, b, "user")
+
+	// все параллельные загрузки получают один и тот же заказ
+	var mu sync.Mutex
+	ids := make(map[uuid.UUID]bool)
+	created := parallel(func(i int) error {
+		accrual := newAccrual(userID, "1001", time.Now())
+		stored, err := b.Accrual.Create(ctx, accrual)
+		if err != nil {
+			return err
+		}
+
+		mu.Lock()
+		ids[stored.ID] = true
+		mu.Unlock()
+
+		if stored.ID != accrual.ID {
+			return storage.ErrDuplicate
+		}
+		return nil
+	})
+	assert.Equal(t, 1, created)
+	assert.Len(t, ids, 1)
+}
+
+func testAccrualUniqueNumber(t *testing.T, b Backend) {
+	ctx := context.Background()
+	userID := newUser(t, b, "user")
+	anotherID := newUser(t, b, "another")
+	require.NoError(t, b.Accrual.Save(ctx, newAccrual(userID, "1001", time.Now())))
+
+	// номер заказа уникален независимо от пользователя
+	assert.ErrorIs(t, b.Accrual.Save(ctx, newAccrual(userID, "1001", time.Now())), storage.ErrDuplicate)
+	assert.ErrorIs(t, b.Accrual.Save(ctx, newAccrual(anotherID, "1001", time.Now())), storage.ErrDuplicate)
+
+	found, err := b.Accrual.FindByNumber(ctx, "1001")
+	require.NoError(t, err)
+	assert.Equal(t, userID, found.UserID)
+}
+
+func testAccrualOrderByCreatedAt(t *testing.T, b Backend) {
+	ctx := context.Background()
+	userID := newUser(t, b, "user")
+	anotherID := newUser(t, b, "another")
+	now := time.Now()
+	require.NoError(t, b.Accrual.Save(ctx, newAccrual(userID, "1002", now.Add(-time.Hour))))
+	require.NoError(t, b.Accrual.Save(ctx, newAccrual(userID, "1000", now.Add(-3*time.Hour))))
+	require.NoError(t, b.Accrual.Save(ctx, newAccrual(anotherID, "2000", now.Add(-4*time.Hour))))
+	require.NoError(t, b.Accrual.Save(ctx, newAccrual(userID, "1001", now.Add(-2*time.Hour))))
+
+	accruals, err := b.Accrual.FindByUser(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1000", "1001", "1002"}, numbers(accruals))
+}
+
+func testAccrualConcurrentSave(t *testing.T, b Backend) {
+	ctx := context.Background()
+	userID := newUser(t, b, "user")
+
+	// разные заказы сохраняются все
+	saved := parallel(func(i int) error {
+		return b.Accrual.Save(ctx, newAccrual(userID, fmt.Sprint(1000+i), time.Now()))
+	})
+	assert.Equal(t, concurrency, saved)
+
+	// из одинаковых номеров сохраняется только один
+	saved = parallel(func(i int) error {
+		return b.Accrual.Save(ctx, newAccrual(userID, "2000", time.Now()))
+	})
+	assert.Equal(t, 1, saved)
+
+	accruals, err := b.Accrual.FindByUser(ctx, userID)
+	require.NoError(t, err)
+	assert.Len(t, accruals, concurrency+1)
+}
+
+func testAccrualFindPage(t *testing.T, b Backend) {
+	ctx := context.Background()
+	userID := newUser(t, b, "user")
+	anotherID := newUser(t, b, "another")
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	// два заказа загружены в одну секунду, их порядок определяет идентификатор
+	var expected []model.Accrual
+	for i, offset := range []int{0, 1, 1, 2, 3, 4} {
+		accrual := newAccrual(userID, fmt.Sprint(1000+i), start.Add(time.Duration(offset)*time.Minute))
+		if i%2 == 1 {
+			accrual.Status = model.StatusProcessed
+		}
+		require.NoError(t, b.Accrual.Save(ctx, accrual))
+		expected = append(expected, accrual)
+	}
+	require.NoError(t, b.Accrual.Save(ctx, newAccrual(anotherID, "2000", start)))
+	sort.Slice(expected, func(i, j int) bool {
+		return model.NewCursor(expected[j].CreatedAt, expected[j].ID).Less(expected[i].CreatedAt, expected[i].ID)
+	})
+
+	// постраничный обход в обоих направлениях возвращает все заказы пользователя
+	for _, desc := range []bool{false, true} {
+		var got []string
+		filter := model.AccrualFilter{PageQuery: model.PageQuery{Desc: desc, Limit: 2}}
+		for {
+			page, err := b.Accrual.FindPage(ctx, userID, filter)
+			require.NoError(t, err)
+			if len(page) == 0 {
+				break
+			}
+			assert.LessOrEqual(t, len(page), 2)
+			got = append(got, numbers(page)...)
+			last := page[len(page)-1]
+			filter.After = model.NewCursor(last.CreatedAt, last.ID)
+		}
+
+		want := numbers(expected)
+		if desc {
+			slices.Reverse(want)
+		}
+		assert.Equal(t, want, got, "desc=%v", desc)
+	}
+
+	// фильтр по статусу и периоду загрузки
+	page, err := b.Accrual.FindPage(ctx, userID, model.AccrualFilter{
+		PageQuery: model.PageQuery{From: start.Add(time.Minute), To: start.Add(4 * time.Minute), Limit: 10},
+		Statuses:  []string{model.StatusProcessed},
+	})
+	require.NoError(t, err)
+	for _, accrual := range page {
+		assert.Equal(t, model.StatusProcessed, accrual.Status)
+		assert.False(t, accrual.CreatedAt.Before(start.Add(time.Minute)))
+		assert.True(t, accrual.CreatedAt.Before(start.Add(4*time.Minute)))
+	}
+	assert.ElementsMatch(t, []string{"1001", "1003"}, numbers(page))
+}
+
+func testAccrualClaimForSync(t *testing.T, b Backend) {
+	ctx := context.Background()
+	userID := newUser(t, b, "user")
+	now := time.Now()
+
+	processing := newAccrual(userID, "1001", now)
+	processing.Status = model.StatusProcessing
+	processed := newAccrual(userID, "1002", now)
+	processed.Status = model.StatusProcessed
+	later := newAccrual(userID, "1003", now)
+	later.NextCheckAt = now.Add(time.Hour)
+
+	for _, accrual := range []model.Accrual{newAccrual(userID, "1000", now), processing, processed, later} {
+		require.NoError(t, b.Accrual.Save(ctx, accrual))
+	}
+
+	// берутся только незавершённые заказы, которые пора проверить
+	claimed, err := b.Accrual.ClaimForSync(ctx, "first", 10, time.Minute)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"1000", "1001"}, numbers(claimed))
+
+	// арендованные заказы не достаются другому экземпляру
+	again, err := b.Accrual.ClaimForSync(ctx, "second", 10, time.Minute)
+	require.NoError(t, err)
+	assert.Empty(t, again)
+
+	// сохранение снимает аренду
+	require.NoError(t, b.Accrual.Save(ctx, claimed[0]))
+	again, err = b.Accrual.ClaimForSync(ctx, "second", 10, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, []string{claimed[0].Number}, numbers(again))
+
+	// истёкшая аренда не мешает взять заказ
+	require.NoError(t, b.Accrual.Save(ctx, newAccrual(userID, "1004", now)))
+	expired, err := b.Accrual.ClaimForSync(ctx, "third", 10, -time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1004"}, numbers(expired))
+	again, err = b.Accrual.ClaimForSync(ctx, "fourth", 10, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1004"}, numbers(again))
+}
+
+func testBalanceEmpty(t *testing.T, b Backend) {
+	userID := newUser(t, b, "user")
+
+	// у пользователя без движений нулевой баланс
+	balance, err := b.Balance.FindByUser(context.Background(), userID)
+	require.NoError(t, err)
+	assert.Equal(t, model.Balance{UserID: userID}, balance)
+}
+
+func testLedgerPost(t *testing.T, b Backend) {
+	ctx := context.Background()
+	userID := newUser(t, b, "user")
+
+	// у отсутствующего снимка версия 0, и она тоже проверяется
+	balance, err := b.Balance.FindByUser(ctx, userID)
+	require.NoError(t, err)
+	accrual := model.NewAccrualEntry(userID, "1000", 72998)
+	accrual.BalanceVersion = &balance.Version
+	require.NoError(t, b.Ledger.Post(ctx, accrual))
+	stale := model.NewAccrualEntry(userID, "1002", 100)
+	stale.BalanceVersion = &balance.Version
+	assert.ErrorIs(t, b.Ledger.Post(ctx, stale), storage.ErrConflict)
+
+	balance, err = b.Balance.FindByUser(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, model.Money(72998), balance.Accrual)
+	assert.Equal(t, model.Money(0), balance.Withdrawal)
+
+	// списание по прочитанной версии снимка
+	withdrawal := model.NewWithdrawalEntry(userID, "2000", 70050)
+	version := balance.Version
+	withdrawal.BalanceVersion = &version
+	require.NoError(t, b.Ledger.Post(ctx, withdrawal))
+
+	// повторная запись по тому же основанию отклоняется
+	err = b.Ledger.Post(ctx, model.NewAccrualEntry(userID, "1000", 100))
+	assert.ErrorIs(t, err, storage.ErrDuplicate)
+
+	// запись по устаревшей версии снимка отклоняется
+	stale = model.NewWithdrawalEntry(userID, "2001", 100)
+	stale.BalanceVersion = &version
+	assert.ErrorIs(t, b.Ledger.Post(ctx, stale), storage.ErrConflict)
+
+	// несбалансированная запись отклоняется
+	unbalanced := model.NewAccrualEntry(userID, "1001", 100)
+	unbalanced.Postings = unbalanced.Postings[1:]
+	assert.Error(t, b.Ledger.Post(ctx, unbalanced))
+
+	balance, err = b.Balance.FindByUser(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, model.Money(72998), balance.Accrual)
+	assert.Equal(t, model.Money(70050), balance.Withdrawal)
+	assert.Equal(t, version+1, balance.Version)
+}
+
+func testLedgerConcurrentPost(t *testing.T, b Backend) {
+	ctx := context.Background()
+	userID := newUser(t, b, "user")
+
+	// записи без проверки версии не теряются при параллельной записи
+	posted := parallel(func(i int) error {
+		return b.Ledger.Post(ctx, model.NewAccrualEntry(userID, fmt.Sprint(1000+i), 150))
+	})
+	assert.Equal(t, concurrency, posted)
+
+	balance, err := b.Balance.FindByUser(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, model.Money(150*concurrency), balance.Accrual)
+	assert.Equal(t, int64(concurrency), balance.Version)
+}
+
+func testWithdrawalCreateAndFind(t *testing.T, b Backend) {
+	ctx := context.Background()
+	userID := newUser(t, b, "user")
+	withdrawal := newWithdrawal(userID, "2000", time.Now())
+	require.NoError(t, b.Withdrawal.Create(ctx, withdrawal))
+
+	withdrawals, err := b.Withdrawal.FindByUser(ctx, userID)
+	require.NoError(t, err)
+	require.Len(t, withdrawals, 1)
+	assert.Equal(t, withdrawal.ID, withdrawals[0].ID)
+	assert.Equal(t, withdrawal.UserID, withdrawals[0].UserID)
+	assert.Equal(t, withdrawal.Number, withdrawals[0].Number)
+	assert.Equal(t, withdrawal.Sum, withdrawals[0].Sum)
+	assert.WithinDuration(t, withdrawal.CreatedAt, withdrawals[0].CreatedAt, time.Second)
+}
+
+func testWithdrawalUniqueNumber(t *testing.T, b Backend) {
+	ctx := context.Background()
+	userID := newUser(t, b, "user")
+	anotherID := newUser(t, b, "another")
+	require.NoError(t, b.Withdrawal.Create(ctx, newWithdrawal(userID, "2000", time.Now())))
+	assert.ErrorIs(t, b.Withdrawal.Create(ctx, newWithdrawal(anotherID, "2000", time.Now())), storage.ErrDuplicate)
+
+	withdrawals, err := b.Withdrawal.FindByUser(ctx, anotherID)
+	require.NoError(t, err)
+	assert.Empty(t, withdrawals)
+}
+
+func testWithdrawalOrderByCreatedAt(t *testing.T, b Backend) {
+	ctx := context.Background()
+	userID := newUser(t, b, "user")
+	now := time.Now()
+	require.NoError(t, b.Withdrawal.Create(ctx, newWithdrawal(userID, "2001", now.Add(-time.Hour))))
+	require.NoError(t, b.Withdrawal.Create(ctx, newWithdrawal(userID, "2000", now.Add(-2*time.Hour))))
+
+	withdrawals, err := b.Withdrawal.FindByUser(ctx, userID)
+	require.NoError(t, err)
+	require.Len(t, withdrawals, 2)
+	assert.Equal(t, "2000", withdrawals[0].Number)
+	assert.Equal(t, "2001", withdrawals[1].Number)
+}
+
+func testWithdrawalFindPage(t *testing.T, b Backend) {
+	ctx := context.Background()
+	userID := newUser(t, b, "user")
+	anotherID := newUser(t, b, "another")
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	// два списания в одну секунду упорядочиваются по идентификатору
+	var expected []model.Withdrawal
+	for i, offset := range []int{0, 1, 1, 2, 3} {
+		withdrawal := newWithdrawal(userID, fmt.Sprint(2000+i), start.Add(time.Duration(offset)*time.Minute))
+		require.NoError(t, b.Withdrawal.Create(ctx, withdrawal))
+		expected = append(expected, withdrawal)
+	}
+	require.NoError(t, b.Withdrawal.Create(ctx, newWithdrawal(anotherID, "3000", start)))
+	sort.Slice(expected, func(i, j int) bool {
+		return model.NewCursor(expected[j].CreatedAt, expected[j].ID).Less(expected[i].CreatedAt, expected[i].ID)
+	})
+
+	for _, desc := range []bool{false, true} {
+		var got, want []string
+		page := model.PageQuery{Desc: desc, Limit: 2}
+		for {
+			withdrawals, err := b.Withdrawal.FindPage(ctx, userID, page)
+			require.NoError(t, err)
+			if len(withdrawals) == 0 {
+				break
+			}
+			assert.LessOrEqual(t, len(withdrawals), 2)
+			for _, withdrawal := range withdrawals {
+				got = append(got, withdrawal.Number)
+			}
+			last := withdrawals[len(withdrawals)-1]
+			page.After = model.NewCursor(last.CreatedAt, last.ID)
+		}
+
+		for _, withdrawal := range expected {
+			want = append(want, withdrawal.Number)
+		}
+		if desc {
+			slices.Reverse(want)
+		}
+		assert.Equal(t, want, got, "desc=%v", desc)
+	}
+
+	// период: from включительно, to не включительно
+	withdrawals, err := b.Withdrawal.FindPage(ctx, userID, model.PageQuery{
+		From:  start.Add(time.Minute),
+		To:    start.Add(3 * time.Minute),
+		Limit: 10,
+	})
+	require.NoError(t, err)
+	assert.Len(t, withdrawals, 3)
+}
+
+func testWithdrawalTotal(t *testing.T, b Backend) {
+	ctx := context.Background()
+	userID := newUser(t, b, "user")
+	anotherID := newUser(t, b, "another")
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	// без списаний сумма нулевая
+	total, err := b.Withdrawal.Total(ctx, userID, model.PageQuery{})
+	require.NoError(t, err)
+	assert.Equal(t, model.Money(0), total)
+
+	for i, sum := range []model.Money{10050, 2099, 1} {
+		withdrawal := newWithdrawal(userID, fmt.Sprint(2000+i), start.Add(time.Duration(i)*time.Minute))
+		withdrawal.Sum = sum
+		require.NoError(t, b.Withdrawal.Create(ctx, withdrawal))
+	}
+	require.NoError(t, b.Withdrawal.Create(ctx, newWithdrawal(anotherID, "3000", start)))
+
+	total, err = b.Withdrawal.Total(ctx, userID, model.PageQuery{})
+	require.NoError(t, err)
+	assert.Equal(t, model.Money(12150), total)
+
+	// курсор и размер страницы на сумму не влияют
+	total, err = b.Withdrawal.Total(ctx, userID, model.PageQuery{
+		From:  start.Add(time.Minute),
+		After: model.NewCursor(start.Add(2*time.Minute), uuid.New()),
+		Limit: 1,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, model.Money(2100), total)
+}
+
+func testStatement(t *testing.T, b Backend) {
+	ctx := context.Background()
+	userID := newUser(t, b, "user")
+	anotherID := newUser(t, b, "another")
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	// выписка строится по проводкам журнала на счёте пользователя и датируется ими
+	sum := model.Money(10050)
+	post := func(entry model.Entry, at time.Time) model.Entry {
+		entry.CreatedAt = at
+		require.NoError(t, b.Ledger.Post(ctx, entry))
+		return entry
+	}
+	post(model.Entry{
+		ID:        userID,
+		UserID:    userID,
+		Kind:      model.EntryOpening,
+		Reference: "opening:" + userID.String(),
+		Postings: []model.Posting{
+			{Account: model.AccountOpening, Amount: -500},
+			{Account: model.UserAccount(userID), Amount: 500},
+		},
+	}, start.Add(-time.Hour))
+	post(model.NewAccrualEntry(userID, "1000", sum), start)
+	post(model.NewWithdrawalEntry(userID, "2000", 70050), start.Add(time.Minute))
+	later := post(model.NewAccrualEntry(userID, "1001", sum), start.Add(2*time.Minute))
+	post(model.NewWithdrawalEntry(anotherID, "3000", 100), start)
+
+	// заказ без начисления в выписку не попадает
+	require.NoError(t, b.Accrual.Save(ctx, newAccrual(userID, "1002", start)))
+
+	balance, err := b.Statement.Balance(ctx, userID, start.Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 500+sum, balance)
+
+	// операции за период по времени
+	lines, err := b.Statement.Lines(ctx, userID, model.PageQuery{From: start.Add(time.Minute)}, 0, 10)
+	require.NoError(t, err)
+	if assert.Len(t, lines, 2) {
+		assert.Equal(t, model.EntryWithdrawal, lines[0].Kind)
+		assert.Equal(t, "2000", lines[0].Order)
+		assert.Equal(t, model.Money(-70050), lines[0].Amount)
+		assert.Equal(t, model.EntryAccrual, lines[1].Kind)
+		assert.Equal(t, "1001", lines[1].Order)
+		assert.Equal(t, sum, lines[1].Amount)
+		assert.True(t, lines[1].Time.Equal(later.CreatedAt))
+	}
+
+	// начальный остаток идёт первым и не ссылается на заказ
+	lines, err = b.Statement.Lines(ctx, userID, model.PageQuery{}, 0, 10)
+	require.NoError(t, err)
+	if assert.Len(t, lines, 4) {
+		assert.Equal(t, model.EntryOpening, lines[0].Kind)
+		assert.Empty(t, lines[0].Order)
+		assert.Equal(t, model.Money(500), lines[0].Amount)
+	}
+
+	// операции читаются частями после последней прочитанной записи
+	first, err := b.Statement.Lines(ctx, userID, model.PageQuery{}, 0, 3)
+	require.NoError(t, err)
+	require.Len(t, first, 3)
+	rest, err := b.Statement.Lines(ctx, userID, model.PageQuery{}, first[2].Seq, 3)
+	require.NoError(t, err)
+	if assert.Len(t, rest, 1) {
+		assert.Equal(t, lines[3].ID, rest[0].ID)
+	}
+}
+
+func testStatementSameSecond(t *testing.T, b Backend) {
+	ctx := context.Background()
+	userID := newUser(t, b, "user")
+	now := time.Now().Truncate(time.Second)
+
+	// начисление и его списание в одну секунду, идентификатор списания меньше
+	accrual := model.NewAccrualEntry(userID, "1000", 100)
+	accrual.ID = uuid.MustParse("ffffffff-ffff-4fff-bfff-ffffffffffff")
+	accrual.CreatedAt = now
+	require.NoError(t, b.Ledger.Post(ctx, accrual))
+	withdrawal := model.NewWithdrawalEntry(userID, "2000", 100)
+	withdrawal.ID = uuid.MustParse("00000000-0000-4000-8000-000000000001")
+	withdrawal.CreatedAt = now
+	require.NoError(t, b.Ledger.Post(ctx, withdrawal))
+
+	// операции идут в порядке проводки, и остаток не уходит в минус
+	lines, err := b.Statement.Lines(ctx, userID, model.PageQuery{}, 0, 10)
+	require.NoError(t, err)
+	if assert.Len(t, lines, 2) {
+		assert.Equal(t, model.EntryAccrual, lines[0].Kind)
+		assert.Equal(t, model.EntryWithdrawal, lines[1].Kind)
+	}
+}
+
+func newUser(t *testing.T, b Backend, login string) uuid.UUID {
+	id, err := b.User.Create(context.Background(), login, "hash")
+	require.NoError(t, err)
+	return id
+}
+
+// newRefreshToken создаёт действующий токен; время хранится с точностью до секунды
+func newRefreshToken(userID, familyID uuid.UUID, hash string) userModel.RefreshToken {
+	now := time.Now().Truncate(time.Second)
+	return userModel.RefreshToken{
+		ID:        uuid.New(),
+		UserID:    userID,
+		FamilyID:  familyID,
+		Hash:      hash,
+		Device:    userModel.Device{UserAgent: "test", IP: "127.0.0.1"},
+		CreatedAt: now,
+		ExpiresAt: now.Add(time.Hour),
+	}
+}
+
+func newPasswordReset(userID uuid.UUID, hash string) userModel.PasswordReset {
+	now := time.Now().Truncate(time.Second)
+	return userModel.PasswordReset{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Hash:      hash,
+		CreatedAt: now,
+		ExpiresAt: now.Add(time.Hour),
+	}
+}
+
+// newAccrual создаёт заказ, который пора проверить; время хранится с точностью до секунды
+func newAccrual(userID uuid.UUID, number string, createdAt time.Time) model.Accrual {
+	createdAt = createdAt.Truncate(time.Second)
+	return model.Accrual{
+		ID:          uuid.New(),
+		UserID:      userID,
+		Number:      number,
+		Status:      model.StatusNew,
+		CreatedAt:   createdAt,
+		NextCheckAt: createdAt,
+	}
+}
+
+func newWithdrawal(userID uuid.UUID, number string, createdAt time.Time) model.Withdrawal {
+	return model.Withdrawal{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Number:    number,
+		Sum:       70050,
+		CreatedAt: createdAt.Truncate(time.Second),
+	}
+}
+
+func assertAccrual(t *testing.T, expected, actual model.Accrual) {
+	assert.Equal(t, expected.ID, actual.ID)
+	assert.Equal(t, expected.UserID, actual.UserID)
+	assert.Equal(t, expected.Number, actual.Number)
+	assert.Equal(t, expected.Status, actual.Status)
+	assert.Equal(t, expected.Sum, actual.Sum)
+	assert.Equal(t, expected.Attempts, actual.Attempts)
+	assert.True(t, expected.CreatedAt.Equal(actual.CreatedAt), "created_at: %v != %v", expected.CreatedAt, actual.CreatedAt)
+	assert.True(t, expected.NextCheckAt.Equal(actual.NextCheckAt), "next_check_at: %v != %v", expected.NextCheckAt, actual.NextCheckAt)
+}
+
+func numbers(accruals []model.Accrual) []string {
+	var numbers []string
+	for _, accrual := range accruals {
+		numbers = append(numbers, accrual.Number)
+	}
+	return numbers
+}
+
+// withLocalZone подменяет часовой пояс процесса до конца теста
+func withLocalZone(t *testing.T, offset time.Duration) {
+	local := time.Local
+	time.Local = time.FixedZone(fmt.Sprint("UTC", offset), int(offset.Seconds()))
+	t.Cleanup(func() { time.Local = local })
+}
+
+// parallel выполняет fn одновременно и возвращает количество успешных вызовов
+func parallel(fn func(i int) error) int {
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		succeeded int
+	)
+
+	start := make(chan struct{})
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			if fn(i) == nil {
+				mu.Lock()
+				succeeded++
+				mu.Unlock()
+			}
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	return succeeded
+}
@@ -0,0 +1,97 @@
+package storagetest
+
+import (
+	"context"
+	"database/sql"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/stretchr/testify/require"
+	balanceMock "github.com/yury-kuznetsov/gofermart/internal/balance/mock"
+	balanceRepository "github.com/yury-kuznetsov/gofermart/internal/balance/repository"
+	"github.com/yury-kuznetsov/gofermart/internal/migrations"
+	userMock "github.com/yury-kuznetsov/gofermart/internal/user/mock"
+	userRepository "github.com/yury-kuznetsov/gofermart/internal/user/repository"
+	_ "modernc.org/sqlite"
+	"os"
+	"testing"
+)
+
+func TestMemory(t *testing.T) {
+	Run(t, func(t *testing.T) Backend {
+		balances := &balanceMock.BalanceRepo{}
+		ledger := &balanceMock.LedgerRepo{Balances: balances}
+		return Backend{
+			User:          &userMock.UserRepo{},
+			RefreshToken:  &userMock.RefreshTokenRepo{},
+			Revocation:    &userMock.RevocationRepo{},
+			PasswordReset: &userMock.PasswordResetRepo{},
+			LoginAttempt:  &userMock.LoginAttemptRepo{},
+			Balance:       balances,
+			Ledger:        ledger,
+			Accrual:       &balanceMock.AccrualRepo{},
+			Withdrawal:    &balanceMock.WithdrawalRepo{},
+			Statement:     &balanceMock.StatementRepo{Ledger: ledger},
+		}
+	})
+}
+
+func TestSQLite(t *testing.T) {
+	Run(t, func(t *testing.T) Backend {
+		// каждое соединение с :memory: открывает новую пустую базу
+		db, err := sql.Open("sqlite", ":memory:?_pragma=foreign_keys(1)")
+		require.NoError(t, err)
+		db.SetMaxOpenConns(1)
+		t.Cleanup(func() { _ = db.Close() })
+
+		migrate(t, db)
+
+		backend := sqlBackend(db)
+		backend.Accrual = balanceRepository.NewSQLiteAccrualRepository(db)
+		return backend
+	})
+}
+
+// TestPostgres выполняется, если задан адрес тестовой базы в TEST_DATABASE_URI.
+// Все данные в этой базе удаляются.
+func TestPostgres(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_URI")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URI не задан")
+	}
+
+	db, err := sql.Open("pgx", dsn)
+	require.NoError(t, err)
+	defer db.Close()
+
+	migrate(t, db)
+
+	Run(t, func(t *testing.T) Backend {
+		_, err := db.ExecContext(
+			context.Background(),
+			`TRUNCATE user_login_attempt, user_password_reset, user_token_generation, user_token_revocation, user_refresh_token, ledger_posting, ledger_entry, ledger_account, balance_withdrawal, balance_accrual, balance, "user"`,
+		)
+		require.NoError(t, err)
+
+		return sqlBackend(db)
+	})
+}
+
+func migrate(t *testing.T, db *sql.DB) {
+	migrator, err := migrations.NewMigrator(db)
+	require.NoError(t, err)
+	require.NoError(t, migrator.Up(context.Background()))
+}
+
+func sqlBackend(db *sql.DB) Backend {
+	return Backend{
+		User:          userRepository.NewUserRepository(db),
+		RefreshToken:  userRepository.NewRefreshTokenRepository(db),
+		Revocation:    userRepository.NewRevocationRepository(db),
+		PasswordReset: userRepository.NewPasswordResetRepository(db),
+		LoginAttempt:  userRepository.NewLoginAttemptRepository(db),
+		Balance:       balanceRepository.NewBalanceRepository(db),
+		Ledger:        balanceRepository.NewLedgerRepository(db),
+		Accrual:       balanceRepository.NewAccrualRepository(db),
+		Withdrawal:    balanceRepository.NewWithdrawalRepository(db),
+		Statement:     balanceRepository.NewStatementRepository(db),
+	}
+}
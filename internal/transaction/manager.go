@@ -0,0 +1,80 @@
+package transaction
+
+import (
+	"context"
+	"database/sql"
+)
+
+type key int
+
+const keyTx key = iota
+
+// Executor - общий набор методов *sql.DB и *sql.Tx, которым пользуются репозитории
+type Executor interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// TxManager выполняет функцию в рамках одной транзакции хранилища
+type TxManager interface {
+	WithinTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// ReadTxManager выполняет функцию в транзакции только для чтения с единым снимком данных
+type ReadTxManager interface {
+	WithinReadTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+type Manager struct {
+	db *sql.DB
+}
+
+func NewManager(db *sql.DB) *Manager {
+	return &Manager{db: db}
+}
+
+// WithinTx выполняет fn в транзакции, которая передаётся репозиториям через контекст.
+// Если транзакция в контексте уже открыта, fn выполняется в ней.
+func (m *Manager) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return m.within(ctx, nil, fn)
+}
+
+// WithinReadTx выполняет fn в транзакции только для чтения, все запросы которой видят один снимок данных.
+// Если транзакция в контексте уже открыта, fn выполняется в ней.
+func (m *Manager) WithinReadTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return m.within(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true}, fn)
+}
+
+func (m *Manager) within(ctx context.Context, opts *sql.TxOptions, fn func(ctx context.Context) error) (err error) {
+	if _, ok := ctx.Value(keyTx).(*sql.Tx); ok {
+		return fn(ctx)
+	}
+
+	tx, err := m.db.BeginTx(ctx, opts)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			_ = tx.Rollback()
+			panic(p)
+		}
+		if err != nil {
+			_ = tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	return fn(context.WithValue(ctx, keyTx, tx))
+}
+
+// Conn возвращает транзакцию из контекста, а при её отсутствии - само подключение
+func Conn(ctx context.Context, db *sql.DB) Executor {
+	if tx, ok := ctx.Value(keyTx).(*sql.Tx); ok {
+		return tx
+	}
+
+	return db
+}
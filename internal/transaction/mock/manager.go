@@ -0,0 +1,29 @@
+package mock
+
+import (
+	"context"
+	"sync"
+)
+
+type txKey struct{}
+
+// TxManager выполняет функции последовательно, имитируя изоляцию транзакций
+type TxManager struct {
+	mu sync.Mutex
+}
+
+func (m *TxManager) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	// вложенный вызов выполняется в уже открытой "транзакции"
+	if ctx.Value(txKey{}) != nil {
+		return fn(ctx)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return fn(context.WithValue(ctx, txKey{}, struct{}{}))
+}
+
+func (m *TxManager) WithinReadTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return m.WithinTx(ctx, fn)
+}
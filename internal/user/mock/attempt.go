@@ -0,0 +1,92 @@
+package mock
+
+import (
+	"context"
+	"github.com/yury-kuznetsov/gofermart/internal/storage"
+	"github.com/yury-kuznetsov/gofermart/internal/user/model"
+	"sync"
+	"time"
+)
+
+type LoginAttemptRepo struct {
+	mu       sync.Mutex
+	attempts map[string]model.LoginAttempts
+}
+
+func (r *LoginAttemptRepo) Find(_ context.Context, key string) (model.LoginAttempts, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	attempts, ok := r.attempts[key]
+	if !ok {
+		return model.LoginAttempts{}, storage.ErrNotFound
+	}
+	return attempts, nil
+}
+
+func (r *LoginAttemptRepo) AddFailure(_ context.Context, key string, at, expiredBefore time.Time) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.attempts == nil {
+		r.attempts = make(map[string]model.LoginAttempts)
+	}
+
+	// забываем давние попытки
+	for k, attempts := range r.attempts {
+		if attempts.LastFailureAt.Before(expiredBefore) {
+			delete(r.attempts, k)
+		}
+	}
+
+	attempts := r.attempts[key]
+	attempts.Key = key
+	attempts.Failures++
+	attempts.LastFailureAt = at
+	r.attempts[key] = attempts
+
+	return attempts.Failures, nil
+}
+
+func (r *LoginAttemptRepo) Reserve(_ context.Context, failures int, next model.LoginAttempts, expiredBefore time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.attempts == nil {
+		r.attempts = make(map[string]model.LoginAttempts)
+	}
+
+	for k, attempts := range r.attempts {
+		if k != next.Key && attempts.LastFailureAt.Before(expiredBefore) {
+			delete(r.attempts, k)
+		}
+	}
+
+	// отсутствующая запись считается записью без неудач
+	if r.attempts[next.Key].Failures != failures {
+		return storage.ErrConflict
+	}
+
+	r.attempts[next.Key] = next
+	return nil
+}
+
+func (r *LoginAttemptRepo) Release(_ context.Context, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	attempts, ok := r.attempts[key]
+	if ok && attempts.Failures > 0 {
+		attempts.Failures--
+		r.attempts[key] = attempts
+	}
+	return nil
+}
+
+func (r *LoginAttemptRepo) Delete(_ context.Context, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.attempts, key)
+	return nil
+}
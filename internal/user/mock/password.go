@@ -0,0 +1,71 @@
+package mock
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/yury-kuznetsov/gofermart/internal/storage"
+	"github.com/yury-kuznetsov/gofermart/internal/user/model"
+	"sync"
+	"time"
+)
+
+type PasswordResetRepo struct {
+	mu     sync.Mutex
+	resets []model.PasswordReset
+}
+
+func (r *PasswordResetRepo) Create(_ context.Context, reset model.PasswordReset) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.resets {
+		if existing.ID == reset.ID || existing.Hash == reset.Hash {
+			return storage.ErrDuplicate
+		}
+	}
+
+	reset.UsedAt = nil
+	r.resets = append(r.resets, reset)
+	return nil
+}
+
+func (r *PasswordResetRepo) FindByHash(_ context.Context, hash string) (model.PasswordReset, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, reset := range r.resets {
+		if reset.Hash == hash {
+			return reset, nil
+		}
+	}
+	return model.PasswordReset{}, storage.ErrNotFound
+}
+
+func (r *PasswordResetRepo) MarkUsed(_ context.Context, id uuid.UUID, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, reset := range r.resets {
+		if reset.ID != id {
+			continue
+		}
+		if reset.UsedAt != nil {
+			return storage.ErrConflict
+		}
+		r.resets[i].UsedAt = &at
+		return nil
+	}
+	return storage.ErrConflict
+}
+
+func (r *PasswordResetRepo) RevokeUser(_ context.Context, userID uuid.UUID, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, reset := range r.resets {
+		if reset.UserID == userID && reset.UsedAt == nil {
+			r.resets[i].UsedAt = &at
+		}
+	}
+	return nil
+}
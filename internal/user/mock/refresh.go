@@ -0,0 +1,83 @@
+package mock
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/yury-kuznetsov/gofermart/internal/storage"
+	"github.com/yury-kuznetsov/gofermart/internal/user/model"
+	"sync"
+	"time"
+)
+
+type RefreshTokenRepo struct {
+	mu     sync.Mutex
+	tokens []model.RefreshToken
+}
+
+func (r *RefreshTokenRepo) Create(_ context.Context, token model.RefreshToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, t := range r.tokens {
+		if t.ID == token.ID || t.Hash == token.Hash {
+			return storage.ErrDuplicate
+		}
+	}
+
+	token.UsedAt, token.RevokedAt = nil, nil
+	r.tokens = append(r.tokens, token)
+	return nil
+}
+
+func (r *RefreshTokenRepo) FindByHash(_ context.Context, hash string) (model.RefreshToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, t := range r.tokens {
+		if t.Hash == hash {
+			return t, nil
+		}
+	}
+	return model.RefreshToken{}, storage.ErrNotFound
+}
+
+func (r *RefreshTokenRepo) MarkUsed(_ context.Context, id uuid.UUID, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, t := range r.tokens {
+		if t.ID != id {
+			continue
+		}
+		if t.UsedAt != nil || t.RevokedAt != nil {
+			return storage.ErrConflict
+		}
+		r.tokens[i].UsedAt = &at
+		return nil
+	}
+	return storage.ErrConflict
+}
+
+func (r *RefreshTokenRepo) RevokeFamily(_ context.Context, familyID uuid.UUID, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, t := range r.tokens {
+		if t.FamilyID == familyID && t.RevokedAt == nil {
+			r.tokens[i].RevokedAt = &at
+		}
+	}
+	return nil
+}
+
+func (r *RefreshTokenRepo) RevokeUser(_ context.Context, userID uuid.UUID, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, t := range r.tokens {
+		if t.UserID == userID && t.RevokedAt == nil {
+			r.tokens[i].RevokedAt = &at
+		}
+	}
+	return nil
+}
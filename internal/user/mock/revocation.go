@@ -0,0 +1,60 @@
+package mock
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"sync"
+	"time"
+)
+
+type RevocationRepo struct {
+	mu          sync.RWMutex
+	tokens      map[string]time.Time
+	generations map[uuid.UUID]int
+}
+
+func (r *RevocationRepo) RevokeToken(_ context.Context, jti string, expiresAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.tokens == nil {
+		r.tokens = make(map[string]time.Time)
+	}
+
+	// истёкшие токены хранить незачем
+	now := time.Now()
+	for id, expires := range r.tokens {
+		if expires.Before(now) {
+			delete(r.tokens, id)
+		}
+	}
+
+	r.tokens[jti] = expiresAt
+	return nil
+}
+
+func (r *RevocationRepo) RevokeUser(_ context.Context, userID uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.generations == nil {
+		r.generations = make(map[uuid.UUID]int)
+	}
+	r.generations[userID]++
+	return nil
+}
+
+func (r *RevocationRepo) Generation(_ context.Context, userID uuid.UUID) (int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.generations[userID], nil
+}
+
+func (r *RevocationRepo) IsRevoked(_ context.Context, jti string, userID uuid.UUID, generation int) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	_, revoked := r.tokens[jti]
+	return revoked || r.generations[userID] > generation, nil
+}
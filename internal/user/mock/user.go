@@ -0,0 +1,66 @@
+package mock
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/yury-kuznetsov/gofermart/internal/storage"
+	"github.com/yury-kuznetsov/gofermart/internal/user/model"
+	"sync"
+)
+
+type UserRepo struct {
+	mu    sync.RWMutex
+	users []model.User
+}
+
+func (u *UserRepo) Create(_ context.Context, login, password string) (uuid.UUID, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	for _, user := range u.users {
+		if user.Login == login {
+			return uuid.Nil, storage.ErrDuplicate
+		}
+	}
+
+	id := uuid.New()
+	u.users = append(u.users, model.User{ID: id, Login: login, Password: password})
+	return id, nil
+}
+
+func (u *UserRepo) FindByLogin(_ context.Context, login string) (model.User, error) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	for _, user := range u.users {
+		if user.Login == login {
+			return user, nil
+		}
+	}
+	return model.User{}, storage.ErrNotFound
+}
+
+func (u *UserRepo) FindByID(_ context.Context, id uuid.UUID) (model.User, error) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	for _, user := range u.users {
+		if user.ID == id {
+			return user, nil
+		}
+	}
+	return model.User{}, storage.ErrNotFound
+}
+
+func (u *UserRepo) UpdatePassword(_ context.Context, id uuid.UUID, password string) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	for i, user := range u.users {
+		if user.ID == id {
+			u.users[i].Password = password
+			return nil
+		}
+	}
+	return storage.ErrNotFound
+}
@@ -0,0 +1,10 @@
+package model
+
+import "time"
+
+// LoginAttempts - неудачные попытки входа с одним логином или с одного адреса
+type LoginAttempts struct {
+	Key           string
+	Failures      int
+	LastFailureAt time.Time
+}
@@ -0,0 +1,21 @@
+package model
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// PasswordReset - одноразовый токен сброса пароля, хранится только его хэш
+type PasswordReset struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	Hash      string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
+
+// Active сообщает, можно ли сбросить пароль по токену
+func (r PasswordReset) Active(now time.Time) bool {
+	return r.UsedAt == nil && now.Before(r.ExpiresAt)
+}
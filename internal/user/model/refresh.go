@@ -0,0 +1,33 @@
+package model
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// RefreshToken - долгоживущий токен обновления. Сам токен не хранится, только его хэш.
+// Токены, выпущенные взамен друг друга, образуют семейство с общим FamilyID.
+type RefreshToken struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	FamilyID  uuid.UUID
+	Hash      string
+	Device    Device
+	CreatedAt time.Time
+	ExpiresAt time.Time
+
+	// время обмена на новый токен и время отзыва, nil - ещё не было
+	UsedAt    *time.Time
+	RevokedAt *time.Time
+}
+
+// Device описывает клиента, которому выдан токен
+type Device struct {
+	UserAgent string
+	IP        string
+}
+
+// Active сообщает, можно ли обменять токен на новый
+func (t RefreshToken) Active(now time.Time) bool {
+	return t.UsedAt == nil && t.RevokedAt == nil && now.Before(t.ExpiresAt)
+}
@@ -0,0 +1,68 @@
+// Package notifier доставляет пользователям уведомления. Здесь собраны реализации
+// для локальной работы: в журнал и в файл. Для рассылки по почте или в мессенджеры
+// достаточно реализовать интерфейс service.Notifier.
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/yury-kuznetsov/gofermart/internal/user/model"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// LogNotifier пишет уведомления в журнал сервиса
+type LogNotifier struct{}
+
+func (LogNotifier) NotifyPasswordReset(_ context.Context, user model.User, token string, expiresAt time.Time) error {
+	log.Printf("сброс пароля для %q: токен %s действует до %s", user.Login, token, expiresAt.Format(time.RFC3339))
+	return nil
+}
+
+// FileNotifier дописывает уведомления в файл, по одному JSON-объекту в строке
+type FileNotifier struct {
+	mu   sync.Mutex
+	path string
+}
+
+func NewFileNotifier(path string) *FileNotifier {
+	return &FileNotifier{path: path}
+}
+
+type notification struct {
+	Time      time.Time `json:"time"`
+	Type      string    `json:"type"`
+	Login     string    `json:"login"`
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (n *FileNotifier) NotifyPasswordReset(_ context.Context, user model.User, token string, expiresAt time.Time) error {
+	return n.write(notification{
+		Time:      time.Now(),
+		Type:      "password_reset",
+		Login:     user.Login,
+		Token:     token,
+		ExpiresAt: expiresAt,
+	})
+}
+
+func (n *FileNotifier) write(message notification) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	// файл содержит действующие токены, поэтому доступен только владельцу
+	file, err := os.OpenFile(n.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+
+	if err := json.NewEncoder(file).Encode(message); err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	return file.Close()
+}
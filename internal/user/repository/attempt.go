@@ -0,0 +1,130 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"github.com/yury-kuznetsov/gofermart/internal/storage"
+	"github.com/yury-kuznetsov/gofermart/internal/transaction"
+	"github.com/yury-kuznetsov/gofermart/internal/user/model"
+	"time"
+)
+
+type LoginAttemptRepository struct {
+	db *sql.DB
+}
+
+func NewLoginAttemptRepository(db *sql.DB) *LoginAttemptRepository {
+	return &LoginAttemptRepository{db: db}
+}
+
+func (r *LoginAttemptRepository) Find(ctx context.Context, key string) (model.LoginAttempts, error) {
+	var attempts model.LoginAttempts
+	err := transaction.Conn(ctx, r.db).QueryRowContext(
+		ctx,
+		"SELECT key, failures, last_failure_at FROM user_login_attempt WHERE key = $1",
+		key,
+	).Scan(&attempts.Key, &attempts.Failures, &attempts.LastFailureAt)
+
+	return attempts, storage.Translate(err)
+}
+
+// AddFailure учитывает неудачную попытку и возвращает количество попыток подряд.
+// Попытки, последняя из которых была раньше expiredBefore, забываются.
+func (r *LoginAttemptRepository) AddFailure(
+	ctx context.Context,
+	key string,
+	at time.Time,
+	expiredBefore time.Time,
+) (int, error) {
+	conn := transaction.Conn(ctx, r.db)
+	_, err := conn.ExecContext(
+		ctx,
+		"DELETE FROM user_login_attempt WHERE last_failure_at < $1",
+		expiredBefore.UTC().Format(time.RFC3339),
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	// счётчик увеличивается в базе, чтобы параллельные попытки не потерялись
+	var failures int
+	err = conn.QueryRowContext(
+		ctx,
+		`INSERT INTO user_login_attempt (key, failures, last_failure_at) VALUES ($1, 1, $2)
+		ON CONFLICT (key) DO UPDATE
+			SET failures = user_login_attempt.failures + 1, last_failure_at = excluded.last_failure_at
+		RETURNING failures`,
+		key, at.UTC().Format(time.RFC3339),
+	).Scan(&failures)
+
+	return failures, err
+}
+
+// Reserve записывает попытки next, только если для ключа по-прежнему хранится failures
+// неудач (0 - записи нет), иначе возвращает storage.ErrConflict. Попытки других ключей,
+// последняя из которых была раньше expiredBefore, забываются.
+func (r *LoginAttemptRepository) Reserve(
+	ctx context.Context,
+	failures int,
+	next model.LoginAttempts,
+	expiredBefore time.Time,
+) error {
+	conn := transaction.Conn(ctx, r.db)
+	_, err := conn.ExecContext(
+		ctx,
+		"DELETE FROM user_login_attempt WHERE last_failure_at < $1 AND key <> $2",
+		expiredBefore.UTC().Format(time.RFC3339), next.Key,
+	)
+	if err != nil {
+		return err
+	}
+
+	// сравнение со считанным счётчиком не даёт параллельным попыткам пройти по одному значению
+	var result sql.Result
+	if failures == 0 {
+		result, err = conn.ExecContext(
+			ctx,
+			`INSERT INTO user_login_attempt (key, failures, last_failure_at) VALUES ($1, $2, $3)
+			ON CONFLICT (key) DO UPDATE
+				SET failures = excluded.failures, last_failure_at = excluded.last_failure_at
+				WHERE user_login_attempt.failures = 0`,
+			next.Key, next.Failures, next.LastFailureAt.UTC().Format(time.RFC3339),
+		)
+	} else {
+		result, err = conn.ExecContext(
+			ctx,
+			"UPDATE user_login_attempt SET failures = $1, last_failure_at = $2 WHERE key = $3 AND failures = $4",
+			next.Failures, next.LastFailureAt.UTC().Format(time.RFC3339), next.Key, failures,
+		)
+	}
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return storage.ErrConflict
+	}
+
+	return nil
+}
+
+// Release возвращает одну учтённую попытку, если она не понадобилась
+func (r *LoginAttemptRepository) Release(ctx context.Context, key string) error {
+	_, err := transaction.Conn(ctx, r.db).ExecContext(
+		ctx,
+		"UPDATE user_login_attempt SET failures = failures - 1 WHERE key = $1 AND failures > 0",
+		key,
+	)
+
+	return err
+}
+
+func (r *LoginAttemptRepository) Delete(ctx context.Context, key string) error {
+	_, err := transaction.Conn(ctx, r.db).ExecContext(ctx, "DELETE FROM user_login_attempt WHERE key = $1", key)
+
+	return err
+}
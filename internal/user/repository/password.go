@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"github.com/google/uuid"
+	"github.com/yury-kuznetsov/gofermart/internal/storage"
+	"github.com/yury-kuznetsov/gofermart/internal/transaction"
+	"github.com/yury-kuznetsov/gofermart/internal/user/model"
+	"time"
+)
+
+const passwordResetColumns = "id, user_id, hash, created_at, expires_at, used_at"
+
+type PasswordResetRepository struct {
+	db *sql.DB
+}
+
+func NewPasswordResetRepository(db *sql.DB) *PasswordResetRepository {
+	return &PasswordResetRepository{db: db}
+}
+
+func (r *PasswordResetRepository) Create(ctx context.Context, reset model.PasswordReset) error {
+	_, err := transaction.Conn(ctx, r.db).ExecContext(
+		ctx,
+		"INSERT INTO user_password_reset ("+passwordResetColumns+") VALUES ($1, $2, $3, $4, $5, NULL)",
+		reset.ID,
+		reset.UserID,
+		reset.Hash,
+		reset.CreatedAt.UTC().Format(time.RFC3339),
+		reset.ExpiresAt.UTC().Format(time.RFC3339),
+	)
+
+	return storage.Translate(err)
+}
+
+func (r *PasswordResetRepository) FindByHash(ctx context.Context, hash string) (model.PasswordReset, error) {
+	var reset model.PasswordReset
+	err := transaction.Conn(ctx, r.db).QueryRowContext(
+		ctx,
+		"SELECT "+passwordResetColumns+" FROM user_password_reset WHERE hash = $1",
+		hash,
+	).Scan(&reset.ID, &reset.UserID, &reset.Hash, &reset.CreatedAt, &reset.ExpiresAt, &reset.UsedAt)
+
+	return reset, storage.Translate(err)
+}
+
+// MarkUsed отмечает токен использованным. Если токен уже использован,
+// в том числе параллельным запросом, возвращается storage.ErrConflict.
+func (r *PasswordResetRepository) MarkUsed(ctx context.Context, id uuid.UUID, at time.Time) error {
+	result, err := transaction.Conn(ctx, r.db).ExecContext(
+		ctx,
+		"UPDATE user_password_reset SET used_at = $1 WHERE id = $2 AND used_at IS NULL",
+		at.UTC().Format(time.RFC3339), id,
+	)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return storage.ErrConflict
+	}
+
+	return nil
+}
+
+// RevokeUser отзывает все неиспользованные токены сброса пароля пользователя
+func (r *PasswordResetRepository) RevokeUser(ctx context.Context, userID uuid.UUID, at time.Time) error {
+	_, err := transaction.Conn(ctx, r.db).ExecContext(
+		ctx,
+		"UPDATE user_password_reset SET used_at = $1 WHERE user_id = $2 AND used_at IS NULL",
+		at.UTC().Format(time.RFC3339), userID,
+	)
+
+	return err
+}
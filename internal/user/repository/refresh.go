@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"github.com/google/uuid"
+	"github.com/yury-kuznetsov/gofermart/internal/storage"
+	"github.com/yury-kuznetsov/gofermart/internal/transaction"
+	"github.com/yury-kuznetsov/gofermart/internal/user/model"
+	"time"
+)
+
+const refreshTokenColumns = "id, user_id, family_id, hash, user_agent, ip, created_at, expires_at, used_at, revoked_at"
+
+type RefreshTokenRepository struct {
+	db *sql.DB
+}
+
+func NewRefreshTokenRepository(db *sql.DB) *RefreshTokenRepository {
+	return &RefreshTokenRepository{db: db}
+}
+
+func (r *RefreshTokenRepository) Create(ctx context.Context, token model.RefreshToken) error {
+	_, err := transaction.Conn(ctx, r.db).ExecContext(
+		ctx,
+		"INSERT INTO user_refresh_token ("+refreshTokenColumns+") VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULL, NULL)",
+		token.ID,
+		token.UserID,
+		token.FamilyID,
+		token.Hash,
+		token.Device.UserAgent,
+		token.Device.IP,
+		token.CreatedAt.UTC().Format(time.RFC3339),
+		token.ExpiresAt.UTC().Format(time.RFC3339),
+	)
+
+	return storage.Translate(err)
+}
+
+func (r *RefreshTokenRepository) FindByHash(ctx context.Context, hash string) (model.RefreshToken, error) {
+	var token model.RefreshToken
+	err := transaction.Conn(ctx, r.db).QueryRowContext(
+		ctx,
+		"SELECT "+refreshTokenColumns+" FROM user_refresh_token WHERE hash = $1",
+		hash,
+	).Scan(
+		&token.ID,
+		&token.UserID,
+		&token.FamilyID,
+		&token.Hash,
+		&token.Device.UserAgent,
+		&token.Device.IP,
+		&token.CreatedAt,
+		&token.ExpiresAt,
+		&token.UsedAt,
+		&token.RevokedAt,
+	)
+
+	return token, storage.Translate(err)
+}
+
+// MarkUsed отмечает токен обменянным. Если токен уже обменян или отозван,
+// в том числе параллельным запросом, возвращается storage.ErrConflict.
+func (r *RefreshTokenRepository) MarkUsed(ctx context.Context, id uuid.UUID, at time.Time) error {
+	result, err := transaction.Conn(ctx, r.db).ExecContext(
+		ctx,
+		"UPDATE user_refresh_token SET used_at = $1 WHERE id = $2 AND used_at IS NULL AND revoked_at IS NULL",
+		at.UTC().Format(time.RFC3339), id,
+	)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return storage.ErrConflict
+	}
+
+	return nil
+}
+
+// RevokeFamily отзывает все ещё не отозванные токены семейства
+func (r *RefreshTokenRepository) RevokeFamily(ctx context.Context, familyID uuid.UUID, at time.Time) error {
+	_, err := transaction.Conn(ctx, r.db).ExecContext(
+		ctx,
+		"UPDATE user_refresh_token SET revoked_at = $1 WHERE family_id = $2 AND revoked_at IS NULL",
+		at.UTC().Format(time.RFC3339), familyID,
+	)
+
+	return err
+}
+
+// RevokeUser отзывает все ещё не отозванные токены пользователя
+func (r *RefreshTokenRepository) RevokeUser(ctx context.Context, userID uuid.UUID, at time.Time) error {
+	_, err := transaction.Conn(ctx, r.db).ExecContext(
+		ctx,
+		"UPDATE user_refresh_token SET revoked_at = $1 WHERE user_id = $2 AND revoked_at IS NULL",
+		at.UTC().Format(time.RFC3339), userID,
+	)
+
+	return err
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"database/sql"
 	"github.com/google/uuid"
+	"github.com/yury-kuznetsov/gofermart/internal/storage"
+	"github.com/yury-kuznetsov/gofermart/internal/transaction"
 	"github.com/yury-kuznetsov/gofermart/internal/user/model"
 )
 
@@ -12,22 +14,14 @@ type UserRepository struct {
 }
 
 func NewUserRepository(db *sql.DB) *UserRepository {
-	r := &UserRepository{db: db}
-
-	_, _ = r.db.Exec(`CREATE TABLE IF NOT EXISTS "user" (
-		id       uuid    not null constraint users_pk primary key,
-		login    varchar not null constraint users_pk_2 unique,
-		password varchar not null
-	)`)
-
-	return r
+	return &UserRepository{db: db}
 }
 
 func (r *UserRepository) Create(ctx context.Context, login, password string) (uuid.UUID, error) {
 	id := uuid.New()
 	query := `INSERT INTO "user" (id, login, password) VALUES ($1, $2, $3)`
-	if _, err := r.db.ExecContext(ctx, query, id, login, password); err != nil {
-		return uuid.Nil, err
+	if _, err := transaction.Conn(ctx, r.db).ExecContext(ctx, query, id, login, password); err != nil {
+		return uuid.Nil, storage.Translate(err)
 	}
 
 	return id, nil
@@ -35,11 +29,43 @@ func (r *UserRepository) Create(ctx context.Context, login, password string) (uu
 
 func (r *UserRepository) FindByLogin(ctx context.Context, login string) (model.User, error) {
 	var user model.User
-	err := r.db.QueryRowContext(
+	err := transaction.Conn(ctx, r.db).QueryRowContext(
 		ctx,
 		`SELECT id, login, password FROM "user" WHERE login = $1`,
 		login,
 	).Scan(&user.ID, &user.Login, &user.Password)
 
-	return user, err
+	return user, storage.Translate(err)
+}
+
+func (r *UserRepository) FindByID(ctx context.Context, id uuid.UUID) (model.User, error) {
+	var user model.User
+	err := transaction.Conn(ctx, r.db).QueryRowContext(
+		ctx,
+		`SELECT id, login, password FROM "user" WHERE id = $1`,
+		id,
+	).Scan(&user.ID, &user.Login, &user.Password)
+
+	return user, storage.Translate(err)
+}
+
+func (r *UserRepository) UpdatePassword(ctx context.Context, id uuid.UUID, password string) error {
+	result, err := transaction.Conn(ctx, r.db).ExecContext(
+		ctx,
+		`UPDATE "user" SET password = $1 WHERE id = $2`,
+		password, id,
+	)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return storage.ErrNotFound
+	}
+
+	return nil
 }
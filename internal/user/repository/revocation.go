@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"github.com/google/uuid"
+	"github.com/yury-kuznetsov/gofermart/internal/transaction"
+	"time"
+)
+
+type RevocationRepository struct {
+	db *sql.DB
+}
+
+func NewRevocationRepository(db *sql.DB) *RevocationRepository {
+	return &RevocationRepository{db: db}
+}
+
+// RevokeToken вносит токен в список отозванных, попутно удаляя из списка истёкшие токены
+func (r *RevocationRepository) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	conn := transaction.Conn(ctx, r.db)
+	_, err := conn.ExecContext(
+		ctx,
+		"DELETE FROM user_token_revocation WHERE expires_at < $1",
+		time.Now().Format(time.RFC3339),
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = conn.ExecContext(
+		ctx,
+		"INSERT INTO user_token_revocation (jti, expires_at) VALUES ($1, $2) ON CONFLICT (jti) DO NOTHING",
+		jti, expiresAt.Format(time.RFC3339),
+	)
+
+	return err
+}
+
+// RevokeUser переводит пользователя на следующее поколение токенов
+func (r *RevocationRepository) RevokeUser(ctx context.Context, userID uuid.UUID) error {
+	_, err := transaction.Conn(ctx, r.db).ExecContext(
+		ctx,
+		`INSERT INTO user_token_generation (user_id, generation) VALUES ($1, 1)
+		ON CONFLICT (user_id) DO UPDATE SET generation = user_token_generation.generation + 1`,
+		userID,
+	)
+
+	return err
+}
+
+func (r *RevocationRepository) Generation(ctx context.Context, userID uuid.UUID) (int, error) {
+	var generation int
+	err := transaction.Conn(ctx, r.db).QueryRowContext(
+		ctx,
+		"SELECT coalesce(max(generation), 0) FROM user_token_generation WHERE user_id = $1",
+		userID,
+	).Scan(&generation)
+
+	return generation, err
+}
+
+// IsRevoked проверяет, отозван ли токен сам по себе или вместе с его поколением
+func (r *RevocationRepository) IsRevoked(
+	ctx context.Context,
+	jti string,
+	userID uuid.UUID,
+	generation int,
+) (bool, error) {
+	var revoked bool
+	err := transaction.Conn(ctx, r.db).QueryRowContext(
+		ctx,
+		`SELECT EXISTS (SELECT 1 FROM user_token_revocation WHERE jti = $1)
+			OR EXISTS (SELECT 1 FROM user_token_generation WHERE user_id = $2 AND generation > $3)`,
+		jti, userID, generation,
+	).Scan(&revoked)
+
+	return revoked, err
+}
@@ -0,0 +1,155 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/yury-kuznetsov/gofermart/internal/storage"
+	"github.com/yury-kuznetsov/gofermart/internal/user/model"
+	"time"
+)
+
+// параметры защиты от подбора пароля
+const (
+	// неудачных попыток без задержки: для логина и для адреса, за которым может быть много клиентов
+	loginFreeAttempts = 5
+	ipFreeAttempts    = 20
+
+	// задержка после первой лишней попытки, каждая следующая удваивает её вплоть до блокировки
+	attemptDelay = time.Second
+	maxLockout   = 15 * time.Minute
+
+	// попытки забываются, если неудачных не было дольше этого времени
+	attemptWindow = time.Hour
+
+	// сколько раз повторить учёт попытки, если счётчик изменил параллельный запрос
+	reserveRetries = 3
+)
+
+var ErrTooManyAttempts = errors.New("слишком много попыток")
+
+// LockedError сообщает, через сколько можно повторить попытку входа или запрос сброса пароля
+type LockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("%v, повторите через %v", ErrTooManyAttempts, e.RetryAfter.Round(time.Second))
+}
+
+func (e *LockedError) Unwrap() error {
+	return ErrTooManyAttempts
+}
+
+type LoginAttemptRepository interface {
+	Find(ctx context.Context, key string) (model.LoginAttempts, error)
+	Reserve(ctx context.Context, failures int, next model.LoginAttempts, expiredBefore time.Time) error
+	Release(ctx context.Context, key string) error
+	Delete(ctx context.Context, key string) error
+}
+
+// LoginGuard ограничивает подбор пароля: после нескольких неудачных попыток входа
+// с одним логином или с одного адреса следующая попытка возможна только после
+// задержки, которая растёт с каждой неудачей до временной блокировки.
+// Каждая попытка считается неудачной, пока вход не подтверждён.
+type LoginGuard struct {
+	r LoginAttemptRepository
+}
+
+func NewLoginGuard(repository LoginAttemptRepository) *LoginGuard {
+	return &LoginGuard{r: repository}
+}
+
+// Reserve учитывает попытку входа до проверки пароля и возвращает *LockedError, если входить
+// с этим логином или с этого адреса пока нельзя. Попытка учитывается сравнением со считанным
+// счётчиком, поэтому параллельные запросы не проходят по одному значению счётчика.
+// После успешного входа попытку снимает Succeed.
+func (g *LoginGuard) Reserve(ctx context.Context, login, ip string) error {
+	return g.reserve(ctx, login, ip, time.Now())
+}
+
+// Succeed сбрасывает счётчик неудачных попыток для логина и снимает попытку, учтённую для адреса.
+// Прежние неудачи адреса остаются, иначе перебор чужих паролей можно было бы перемежать
+// входом в свою учётную запись.
+func (g *LoginGuard) Succeed(ctx context.Context, login, ip string) error {
+	if err := g.r.Delete(ctx, loginKey(login)); err != nil {
+		return err
+	}
+
+	return g.r.Release(ctx, ipKey(ip))
+}
+
+func (g *LoginGuard) reserve(ctx context.Context, login, ip string, now time.Time) error {
+	keys := []struct {
+		key  string
+		free int
+	}{
+		{key: loginKey(login), free: loginFreeAttempts},
+		{key: ipKey(ip), free: ipFreeAttempts},
+	}
+
+	for i, key := range keys {
+		err := g.reserveKey(ctx, key.key, key.free, now)
+		if err == nil {
+			continue
+		}
+
+		// попытка не состоялась, уже учтённые для других ключей снимаются
+		for _, reserved := range keys[:i] {
+			if releaseErr := g.r.Release(ctx, reserved.key); releaseErr != nil {
+				return errors.Join(err, releaseErr)
+			}
+		}
+		return err
+	}
+
+	return nil
+}
+
+// reserveKey учитывает попытку для одного ключа, если задержка после прежних неудач истекла
+func (g *LoginGuard) reserveKey(ctx context.Context, key string, free int, now time.Time) error {
+	for i := 0; i < reserveRetries; i++ {
+		attempts, err := g.r.Find(ctx, key)
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return err
+		}
+
+		// давние неудачи не учитываются, но сравнивается хранимый счётчик
+		failures := attempts.Failures
+		if attempts.LastFailureAt.Before(now.Add(-attemptWindow)) {
+			failures = 0
+		}
+
+		wait := attempts.LastFailureAt.Add(lockout(failures, free)).Sub(now)
+		if wait > 0 {
+			return &LockedError{RetryAfter: wait}
+		}
+
+		next := model.LoginAttempts{Key: key, Failures: failures + 1, LastFailureAt: now}
+		err = g.r.Reserve(ctx, attempts.Failures, next, now.Add(-attemptWindow))
+		if !errors.Is(err, storage.ErrConflict) {
+			return err
+		}
+	}
+
+	// счётчик всё время меняют параллельные попытки: подбор идёт прямо сейчас
+	return &LockedError{RetryAfter: attemptDelay}
+}
+
+// lockout возвращает задержку после failures неудачных попыток подряд
+func lockout(failures, free int) time.Duration {
+	if failures <= free {
+		return 0
+	}
+
+	delay := attemptDelay << min(failures-free-1, 20)
+	return min(delay, maxLockout)
+}
+
+func loginKey(login string) string {
+	return "login:" + login
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
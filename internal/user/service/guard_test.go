@@ -0,0 +1,140 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yury-kuznetsov/gofermart/internal/user/mock"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLockout(t *testing.T) {
+	testCases := []struct {
+		failures int
+		expected time.Duration
+	}{
+		{failures: 0, expected: 0},
+		{failures: loginFreeAttempts, expected: 0},
+		{failures: loginFreeAttempts + 1, expected: time.Second},
+		{failures: loginFreeAttempts + 2, expected: 2 * time.Second},
+		{failures: loginFreeAttempts + 5, expected: 16 * time.Second},
+		{failures: loginFreeAttempts + 20, expected: maxLockout},
+		{failures: loginFreeAttempts + 100, expected: maxLockout},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.expected, lockout(tc.failures, loginFreeAttempts), tc.failures)
+	}
+}
+
+func TestLoginGuardByLogin(t *testing.T) {
+	ctx := context.Background()
+	guard := NewLoginGuard(&mock.LoginAttemptRepo{})
+	now := time.Now()
+
+	// первые попытки не ограничиваются, каждая считается неудачной до успешного входа
+	for i := 0; i <= loginFreeAttempts; i++ {
+		require.NoError(t, guard.reserve(ctx, "user", "10.0.0.1", now))
+	}
+
+	// подбор с разных адресов всё равно упирается в ограничение логина
+	err := guard.reserve(ctx, "user", "10.0.0.3", now)
+	assert.ErrorIs(t, err, ErrTooManyAttempts)
+	var locked *LockedError
+	if assert.ErrorAs(t, err, &locked) {
+		assert.Equal(t, time.Second, locked.RetryAfter)
+	}
+
+	// другие логины не затронуты
+	assert.NoError(t, guard.reserve(ctx, "another", "10.0.0.3", now))
+
+	// после задержки можно повторить, следующая неудача удваивает задержку
+	later := now.Add(time.Second)
+	require.NoError(t, guard.reserve(ctx, "user", "10.0.0.3", later))
+	assert.ErrorAs(t, guard.reserve(ctx, "user", "10.0.0.3", later.Add(time.Second)), &locked)
+	assert.Equal(t, time.Second, locked.RetryAfter)
+
+	// успешный вход сбрасывает счётчик логина
+	require.NoError(t, guard.Succeed(ctx, "user", "10.0.0.3"))
+	assert.NoError(t, guard.reserve(ctx, "user", "10.0.0.3", later))
+}
+
+func TestLoginGuardByIP(t *testing.T) {
+	ctx := context.Background()
+	attempts := &mock.LoginAttemptRepo{}
+	guard := NewLoginGuard(attempts)
+	now := time.Now()
+
+	// перебор логинов с одного адреса
+	for i := 0; i <= ipFreeAttempts; i++ {
+		require.NoError(t, guard.reserve(ctx, fmt.Sprint("user", i), "10.0.0.1", now))
+	}
+
+	assert.ErrorIs(t, guard.reserve(ctx, "fresh", "10.0.0.1", now), ErrTooManyAttempts)
+
+	// отклонённая попытка не учитывается для логина
+	fresh, err := attempts.Find(ctx, loginKey("fresh"))
+	require.NoError(t, err)
+	assert.Equal(t, 0, fresh.Failures)
+
+	require.NoError(t, guard.reserve(ctx, "fresh", "10.0.0.2", now))
+
+	// успешный вход снимает только свою попытку и не снимает ограничение адреса
+	require.NoError(t, guard.reserve(ctx, "user0", "10.0.0.2", now))
+	require.NoError(t, guard.Succeed(ctx, "user0", "10.0.0.2"))
+	ip, err := attempts.Find(ctx, ipKey("10.0.0.2"))
+	require.NoError(t, err)
+	assert.Equal(t, 1, ip.Failures)
+
+	assert.ErrorIs(t, guard.reserve(ctx, "user0", "10.0.0.1", now), ErrTooManyAttempts)
+}
+
+func TestLoginGuardWindow(t *testing.T) {
+	ctx := context.Background()
+	attempts := &mock.LoginAttemptRepo{}
+	guard := NewLoginGuard(attempts)
+	now := time.Now()
+
+	for i := 0; i < loginFreeAttempts+20; i++ {
+		_, err := attempts.AddFailure(ctx, loginKey("user"), now, now.Add(-attemptWindow))
+		require.NoError(t, err)
+	}
+	assert.ErrorIs(t, guard.reserve(ctx, "user", "10.0.0.1", now.Add(maxLockout-time.Second)), ErrTooManyAttempts)
+
+	// блокировка временная
+	assert.NoError(t, guard.reserve(ctx, "user", "10.0.0.1", now.Add(maxLockout)))
+
+	// давние неудачи забываются, и счёт начинается заново
+	later := now.Add(attemptWindow + time.Hour)
+	require.NoError(t, guard.reserve(ctx, "user", "10.0.0.1", later))
+	found, err := attempts.Find(ctx, loginKey("user"))
+	require.NoError(t, err)
+	assert.Equal(t, 1, found.Failures)
+}
+
+func TestLoginGuardConcurrent(t *testing.T) {
+	ctx := context.Background()
+	guard := NewLoginGuard(&mock.LoginAttemptRepo{})
+	now := time.Now()
+
+	// параллельные попытки не проходят сверх разрешённых, пока пароль ещё проверяется
+	var wg sync.WaitGroup
+	var passed atomic.Int32
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if guard.reserve(ctx, "user", "10.0.0.1", now) == nil {
+				passed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.LessOrEqual(t, int(passed.Load()), loginFreeAttempts+1)
+	assert.ErrorIs(t, guard.reserve(ctx, "user", "10.0.0.2", now), ErrTooManyAttempts)
+}
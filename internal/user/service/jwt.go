@@ -1,62 +1,121 @@
 package service
 
 import (
-	"fmt"
+	"context"
+	"errors"
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/google/uuid"
 	"time"
 )
 
-const (
-	SecretKey = "SECRET_KEY"
-	Duration  = time.Hour
-)
+const Duration = time.Hour
+
+var ErrInvalidToken = errors.New("недействительный токен")
+
+// RevocationRepository хранит отозванные токены доступа: отдельные токены по jti
+// до истечения их срока и поколение токенов пользователя, которое растёт при выходе
+// со всех устройств и делает недействительными токены прежних поколений
+type RevocationRepository interface {
+	RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error
+	RevokeUser(ctx context.Context, userID uuid.UUID) error
+	Generation(ctx context.Context, userID uuid.UUID) (int, error)
+	IsRevoked(ctx context.Context, jti string, userID uuid.UUID, generation int) (bool, error)
+}
 
-type JWTService struct{}
+type JWTService struct {
+	keys *KeySet
+	r    RevocationRepository
+}
 
 type Claims struct {
 	jwt.RegisteredClaims
 	UserID uuid.UUID
+
+	// сессия, то есть семейство токенов обновления, к которой относится токен
+	SessionID uuid.UUID `json:"sid"`
+
+	// поколение токенов пользователя на момент выдачи
+	Generation int `json:"gen"`
 }
 
-func NewTokenService() *JWTService {
-	return &JWTService{}
+func NewTokenService(keys *KeySet, revocations RevocationRepository) *JWTService {
+	return &JWTService{keys: keys, r: revocations}
 }
 
-func (s *JWTService) GenerateToken(userID uuid.UUID) string {
+func (s *JWTService) GenerateToken(ctx context.Context, userID, sessionID uuid.UUID) (string, error) {
 	if userID == uuid.Nil {
-		return ""
+		return "", ErrInvalidToken
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
+	generation, err := s.r.Generation(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	return s.keys.sign(Claims{
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(Duration)),
+			ID:        uuid.NewString(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(Duration)),
 		},
-		UserID: userID,
+		UserID:     userID,
+		SessionID:  sessionID,
+		Generation: generation,
 	})
-
-	tokenString, _ := token.SignedString([]byte(SecretKey))
-
-	return tokenString
 }
 
-func (s *JWTService) GetUserID(tokenString string) uuid.UUID {
-	claims := &Claims{}
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
+// GetUserID проверяет токен и возвращает идентификатор пользователя.
+// Для поддельных, просроченных и отозванных токенов возвращается ErrInvalidToken.
+func (s *JWTService) GetUserID(ctx context.Context, tokenString string) (uuid.UUID, error) {
+	claims, err := s.parse(tokenString)
+	if err != nil {
+		return uuid.Nil, err
+	}
 
-		return []byte(SecretKey), nil
-	})
+	revoked, err := s.r.IsRevoked(ctx, claims.ID, claims.UserID, claims.Generation)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if revoked {
+		return uuid.Nil, ErrInvalidToken
+	}
 
+	return claims.UserID, nil
+}
+
+// Revoke отзывает токен и возвращает сессию, к которой он относится
+func (s *JWTService) Revoke(ctx context.Context, tokenString string) (uuid.UUID, error) {
+	claims, err := s.parse(tokenString)
 	if err != nil {
-		return uuid.Nil
+		return uuid.Nil, err
+	}
+
+	if err := s.r.RevokeToken(ctx, claims.ID, claims.ExpiresAt.Time); err != nil {
+		return uuid.Nil, err
 	}
 
-	if !token.Valid {
-		return uuid.Nil
+	return claims.SessionID, nil
+}
+
+// RevokeAll отзывает все выданные пользователю токены доступа
+func (s *JWTService) RevokeAll(ctx context.Context, userID uuid.UUID) error {
+	return s.r.RevokeUser(ctx, userID)
+}
+
+// JWKS возвращает открытые ключи для проверки токенов другими сервисами
+func (s *JWTService) JWKS() JWKS {
+	return s.keys.JWKS()
+}
+
+// parse проверяет подпись и срок действия токена. Токены без jti и срока
+// действия сервис не выдаёт, и отозвать их было бы нельзя.
+func (s *JWTService) parse(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, s.keys.verifyKey)
+	if err != nil || !token.Valid || claims.UserID == uuid.Nil || claims.ID == "" || claims.ExpiresAt == nil {
+		return nil, ErrInvalidToken
 	}
 
-	return claims.UserID
+	return claims, nil
 }
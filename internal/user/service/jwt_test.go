@@ -1,12 +1,24 @@
 package service
 
 import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"github.com/golang-jwt/jwt/v4"
 	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/yury-kuznetsov/gofermart/internal/user/mock"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestGenerateToken(t *testing.T) {
-	tokenService := NewTokenService()
+	tokenService := NewTokenService(RandomKeySet(), &mock.RevocationRepo{})
 
 	testCases := []struct {
 		name    string
@@ -26,9 +38,9 @@ func TestGenerateToken(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			token := tokenService.GenerateToken(tc.id)
-			if tc.wantErr && token != "" {
-				t.Errorf("expected empty token, got '%s'", token)
+			token, err := tokenService.GenerateToken(context.Background(), tc.id, uuid.New())
+			if tc.wantErr && err == nil {
+				t.Errorf("expected error, got token '%s'", token)
 				return
 			}
 			if !tc.wantErr && token == "" {
@@ -36,10 +48,197 @@ func TestGenerateToken(t *testing.T) {
 				return
 			}
 
-			parsedID := tokenService.GetUserID(token)
+			parsedID, _ := tokenService.GetUserID(context.Background(), token)
 			if parsedID != tc.id {
 				t.Errorf("expected UUID '%s', got '%s'", tc.id, parsedID)
 			}
 		})
 	}
 }
+
+func TestAsymmetricKeys(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+
+	for _, key := range []Key{NewRSAKey("rsa", rsaKey), NewEdDSAKey("ed", edKey)} {
+		t.Run(key.Method.Alg(), func(t *testing.T) {
+			keys, err := NewKeySet(key.ID, key)
+			assert.NoError(t, err)
+			tokenService := NewTokenService(keys, &mock.RevocationRepo{})
+
+			userID := uuid.New()
+			token := generateToken(t, tokenService, userID)
+			assert.Equal(t, userID, userIDFromToken(tokenService, token))
+
+			// в заголовке токена указан ключ и его алгоритм
+			parsed, _, err := jwt.NewParser().ParseUnverified(token, &Claims{})
+			assert.NoError(t, err)
+			assert.Equal(t, key.ID, parsed.Header["kid"])
+			assert.Equal(t, key.Method.Alg(), parsed.Header["alg"])
+		})
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	oldKey := NewHMACKey("old", []byte("old-secret-old-secret-old-secret"))
+	newKey := NewHMACKey("new", []byte("new-secret-new-secret-new-secret"))
+	userID := uuid.New()
+
+	revocations := &mock.RevocationRepo{}
+
+	before, _ := NewKeySet("old", oldKey)
+	token := generateToken(t, NewTokenService(before, revocations), userID)
+
+	// после смены активного ключа выданные ранее токены продолжают действовать
+	rotated, _ := NewKeySet("new", newKey, oldKey)
+	assert.Equal(t, userID, userIDFromToken(NewTokenService(rotated, revocations), token))
+
+	// после удаления прежнего ключа - нет
+	after, _ := NewKeySet("new", newKey)
+	assert.Equal(t, uuid.Nil, userIDFromToken(NewTokenService(after, revocations), token))
+}
+
+func TestRejectsForeignTokens(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	keys, _ := NewKeySet("rsa", NewRSAKey("rsa", rsaKey))
+	tokenService := NewTokenService(keys, &mock.RevocationRepo{})
+	claims := Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+		UserID: uuid.New(),
+	}
+
+	// токен без kid
+	token, _ := jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(rsaKey)
+	assert.Equal(t, uuid.Nil, userIDFromToken(tokenService, token))
+
+	// подмена алгоритма: HS256 с открытым ключом RSA в качестве секрета
+	public, _ := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	forged.Header["kid"] = "rsa"
+	token, _ = forged.SignedString(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: public}))
+	assert.Equal(t, uuid.Nil, userIDFromToken(tokenService, token))
+
+	// токен, подписанный прежним захардкоженным секретом
+	legacy, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("SECRET_KEY"))
+	assert.Equal(t, uuid.Nil, userIDFromToken(tokenService, legacy))
+}
+
+func TestRevoke(t *testing.T) {
+	ctx := context.Background()
+	tokenService := NewTokenService(RandomKeySet(), &mock.RevocationRepo{})
+	userID := uuid.New()
+	sessionID := uuid.New()
+
+	token, err := tokenService.GenerateToken(ctx, userID, sessionID)
+	assert.NoError(t, err)
+	other := generateToken(t, tokenService, userID)
+
+	// отзыв токена возвращает его сессию и не затрагивает другие токены
+	revokedSession, err := tokenService.Revoke(ctx, token)
+	assert.NoError(t, err)
+	assert.Equal(t, sessionID, revokedSession)
+
+	_, err = tokenService.GetUserID(ctx, token)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	assert.Equal(t, userID, userIDFromToken(tokenService, other))
+
+	_, err = tokenService.Revoke(ctx, "garbage")
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestRevokeAll(t *testing.T) {
+	ctx := context.Background()
+	tokenService := NewTokenService(RandomKeySet(), &mock.RevocationRepo{})
+	userID := uuid.New()
+	stranger := uuid.New()
+
+	before := generateToken(t, tokenService, userID)
+	strangerToken := generateToken(t, tokenService, stranger)
+	assert.NoError(t, tokenService.RevokeAll(ctx, userID))
+
+	// токены, выданные до выхода со всех устройств, отозваны, в том числе в ту же секунду
+	assert.Equal(t, uuid.Nil, userIDFromToken(tokenService, before))
+	assert.Equal(t, userID, userIDFromToken(tokenService, generateToken(t, tokenService, userID)))
+	assert.Equal(t, stranger, userIDFromToken(tokenService, strangerToken))
+}
+
+func TestNewKeySet(t *testing.T) {
+	key := NewHMACKey("a", []byte("secret"))
+
+	_, err := NewKeySet("b", key)
+	assert.Error(t, err)
+
+	_, err = NewKeySet("a", key, key)
+	assert.Error(t, err)
+
+	_, err = NewSecretKeySet("short")
+	assert.Error(t, err)
+}
+
+func TestJWKS(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	edPublic, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	keys, _ := NewKeySet(
+		"rsa",
+		NewRSAKey("rsa", rsaKey),
+		NewEdDSAKey("ed", edKey),
+		NewHMACKey("hmac", []byte("secret")),
+	)
+
+	// секрет HMAC не публикуется
+	jwks := keys.JWKS()
+	if assert.Len(t, jwks.Keys, 2) {
+		assert.Equal(t, JWK{KeyType: "OKP", ID: "ed", Use: "sig", Algorithm: "EdDSA", Curve: "Ed25519",
+			X: jwt.EncodeSegment(edPublic)}, jwks.Keys[0])
+		assert.Equal(t, "RSA", jwks.Keys[1].KeyType)
+		assert.Equal(t, "RS256", jwks.Keys[1].Algorithm)
+		assert.Equal(t, jwt.EncodeSegment(rsaKey.N.Bytes()), jwks.Keys[1].N)
+		assert.Equal(t, "AQAB", jwks.Keys[1].E)
+	}
+}
+
+func TestLoadKeySet(t *testing.T) {
+	dir := t.TempDir()
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	der, _ := x509.MarshalPKCS8PrivateKey(edKey)
+	pemData := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "ed.pem"), pemData, 0o600))
+
+	path := filepath.Join(dir, "keys.json")
+	assert.NoError(t, os.WriteFile(path, []byte(`{
+		"active": "ed",
+		"keys": [
+			{"kid": "old", "alg": "HS256", "secret": "0123456789abcdef0123456789abcdef"},
+			{"kid": "ed", "alg": "EdDSA", "private_key_file": "ed.pem"}
+		]
+	}`), 0o600))
+
+	keys, err := LoadKeySet(path)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "ed", keys.active)
+		assert.Len(t, keys.keys, 2)
+		assert.Equal(t, edKey.Public(), keys.keys["ed"].verifyKey)
+	}
+
+	// короткий секрет HS256 не принимается
+	assert.NoError(t, os.WriteFile(path, []byte(`{
+		"active": "a",
+		"keys": [{"kid": "a", "alg": "HS256", "secret": "short"}]
+	}`), 0o600))
+	_, err = LoadKeySet(path)
+	assert.Error(t, err)
+}
+
+func generateToken(t *testing.T, tokenService *JWTService, userID uuid.UUID) string {
+	token, err := tokenService.GenerateToken(context.Background(), userID, uuid.New())
+	assert.NoError(t, err)
+	return token
+}
+
+func userIDFromToken(tokenService *JWTService, token string) uuid.UUID {
+	userID, _ := tokenService.GetUserID(context.Background(), token)
+	return userID
+}
@@ -0,0 +1,222 @@
+package service
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v4"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+var ErrUnknownKey = errors.New("неизвестный ключ подписи токена")
+
+// минимальная длина секрета HS256, более короткий подбирается перебором
+const minSecretLength = 32
+
+// Key - ключ подписи токенов, его идентификатор передаётся в заголовке kid
+type Key struct {
+	ID     string
+	Method jwt.SigningMethod
+
+	// у HMAC ключи подписи и проверки совпадают, у RSA и EdDSA проверка идёт открытым ключом
+	signKey   any
+	verifyKey any
+}
+
+func NewHMACKey(id string, secret []byte) Key {
+	return Key{ID: id, Method: jwt.SigningMethodHS256, signKey: secret, verifyKey: secret}
+}
+
+func NewRSAKey(id string, key *rsa.PrivateKey) Key {
+	return Key{ID: id, Method: jwt.SigningMethodRS256, signKey: key, verifyKey: &key.PublicKey}
+}
+
+func NewEdDSAKey(id string, key ed25519.PrivateKey) Key {
+	return Key{ID: id, Method: jwt.SigningMethodEdDSA, signKey: key, verifyKey: key.Public()}
+}
+
+// KeySet - действующие ключи: токены подписываются активным ключом, а проверяются любым из набора.
+// Для ротации новый ключ делают активным, а прежний оставляют в наборе, пока не истекут его токены.
+type KeySet struct {
+	active string
+	keys   map[string]Key
+}
+
+func NewKeySet(active string, keys ...Key) (*KeySet, error) {
+	set := &KeySet{active: active, keys: make(map[string]Key, len(keys))}
+	for _, key := range keys {
+		if key.ID == "" {
+			return nil, errors.New("у ключа подписи не задан kid")
+		}
+		if _, ok := set.keys[key.ID]; ok {
+			return nil, fmt.Errorf("ключ подписи %q задан дважды", key.ID)
+		}
+		set.keys[key.ID] = key
+	}
+	if _, ok := set.keys[active]; !ok {
+		return nil, fmt.Errorf("активный ключ подписи %q отсутствует в наборе", active)
+	}
+
+	return set, nil
+}
+
+// NewSecretKeySet создаёт набор из одного ключа HS256
+func NewSecretKeySet(secret string) (*KeySet, error) {
+	if len(secret) < minSecretLength {
+		return nil, fmt.Errorf("секрет HS256 должен быть не короче %d символов", minSecretLength)
+	}
+
+	return NewKeySet("default", NewHMACKey("default", []byte(secret)))
+}
+
+// RandomKeySet создаёт случайный секрет, токены перестанут действовать после перезапуска
+func RandomKeySet() *KeySet {
+	secret := make([]byte, 32)
+	_, _ = rand.Read(secret)
+	set, _ := NewKeySet("random", NewHMACKey("random", secret))
+
+	return set
+}
+
+// keysFile - формат файла ключей подписи
+type keysFile struct {
+	Active string `json:"active"`
+	Keys   []struct {
+		ID  string `json:"kid"`
+		Alg string `json:"alg"`
+
+		// Secret - секрет HS256, PrivateKeyFile - PEM-файл закрытого ключа RS256 или EdDSA
+		Secret         string `json:"secret"`
+		PrivateKeyFile string `json:"private_key_file"`
+	} `json:"keys"`
+}
+
+// LoadKeySet читает набор ключей из JSON-файла. Пути к PEM-файлам
+// отсчитываются от каталога файла ключей.
+func LoadKeySet(path string) (*KeySet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file keysFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("файл ключей %s: %w", path, err)
+	}
+
+	keys := make([]Key, 0, len(file.Keys))
+	for _, k := range file.Keys {
+		if k.Alg == jwt.SigningMethodHS256.Alg() {
+			if len(k.Secret) < minSecretLength {
+				return nil, fmt.Errorf("ключ %q: секрет HS256 должен быть не короче %d символов", k.ID, minSecretLength)
+			}
+			keys = append(keys, NewHMACKey(k.ID, []byte(k.Secret)))
+			continue
+		}
+
+		pemFile := k.PrivateKeyFile
+		if !filepath.IsAbs(pemFile) {
+			pemFile = filepath.Join(filepath.Dir(path), pemFile)
+		}
+		pem, err := os.ReadFile(pemFile)
+		if err != nil {
+			return nil, fmt.Errorf("ключ %q: %w", k.ID, err)
+		}
+
+		switch k.Alg {
+		case jwt.SigningMethodRS256.Alg():
+			private, err := jwt.ParseRSAPrivateKeyFromPEM(pem)
+			if err != nil {
+				return nil, fmt.Errorf("ключ %q: %w", k.ID, err)
+			}
+			keys = append(keys, NewRSAKey(k.ID, private))
+		case jwt.SigningMethodEdDSA.Alg():
+			private, err := jwt.ParseEdPrivateKeyFromPEM(pem)
+			if err != nil {
+				return nil, fmt.Errorf("ключ %q: %w", k.ID, err)
+			}
+			keys = append(keys, NewEdDSAKey(k.ID, private.(ed25519.PrivateKey)))
+		default:
+			return nil, fmt.Errorf("ключ %q: неподдерживаемый алгоритм %q", k.ID, k.Alg)
+		}
+	}
+
+	return NewKeySet(file.Active, keys...)
+}
+
+// sign подписывает токен активным ключом
+func (s *KeySet) sign(claims jwt.Claims) (string, error) {
+	key := s.keys[s.active]
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+
+	return token.SignedString(key.signKey)
+}
+
+// verifyKey выбирает ключ проверки по kid и не допускает подмены алгоритма
+func (s *KeySet) verifyKey(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := s.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKey, kid)
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+
+	return key.verifyKey, nil
+}
+
+// JWK - открытый ключ в формате RFC 7517
+type JWK struct {
+	KeyType   string `json:"kty"`
+	ID        string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+
+	// параметры RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+
+	// параметры EdDSA
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS возвращает открытые ключи, которыми другие сервисы могут проверять токены.
+// Секреты HMAC не публикуются.
+func (s *KeySet) JWKS() JWKS {
+	jwks := JWKS{Keys: []JWK{}}
+	for _, key := range s.keys {
+		jwk := JWK{ID: key.ID, Use: "sig", Algorithm: key.Method.Alg()}
+		switch public := key.verifyKey.(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		default:
+			continue
+		}
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+	sort.Slice(jwks.Keys, func(i, j int) bool {
+		return jwks.Keys[i].ID < jwks.Keys[j].ID
+	})
+
+	return jwks
+}
@@ -0,0 +1,241 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/yury-kuznetsov/gofermart/internal/storage"
+	"github.com/yury-kuznetsov/gofermart/internal/transaction"
+	"github.com/yury-kuznetsov/gofermart/internal/user/model"
+	"golang.org/x/crypto/bcrypt"
+	"time"
+)
+
+// ResetDuration - срок действия токена сброса пароля
+const ResetDuration = time.Hour
+
+// ограничение запросов сброса пароля: не больше стольких за окно для логина и для адреса.
+// Счётчик учитывает и отклонённые запросы, поэтому окно отсчитывается от последнего из них.
+const (
+	loginResetRequests = 3
+	ipResetRequests    = 20
+	resetWindow        = time.Hour
+)
+
+var ErrEmptyPassword = errors.New("пароль не может быть пустым")
+var ErrInvalidResetToken = errors.New("недействительный токен сброса пароля")
+var ErrResetDisabled = errors.New("сброс пароля отключён: не настроена доставка уведомлений")
+
+type PasswordResetRepository interface {
+	Create(ctx context.Context, reset model.PasswordReset) error
+	FindByHash(ctx context.Context, hash string) (model.PasswordReset, error)
+	MarkUsed(ctx context.Context, id uuid.UUID, at time.Time) error
+	RevokeUser(ctx context.Context, userID uuid.UUID, at time.Time) error
+}
+
+// ResetRequestRepository считает запросы сброса пароля по ключу логина или адреса.
+// Счётчик хранится вместе с попытками входа, но под своими ключами.
+type ResetRequestRepository interface {
+	// AddFailure учитывает запрос и возвращает их количество, забывая счётчики старше expiredBefore
+	AddFailure(ctx context.Context, key string, at, expiredBefore time.Time) (int, error)
+}
+
+// Notifier доставляет пользователю токен сброса пароля
+type Notifier interface {
+	NotifyPasswordReset(ctx context.Context, user model.User, token string, expiresAt time.Time) error
+}
+
+// SessionRevoker завершает все сессии пользователя
+type SessionRevoker interface {
+	RevokeAll(ctx context.Context, userID uuid.UUID) error
+}
+
+type PasswordService struct {
+	tx       transaction.TxManager
+	users    UserRepository
+	resets   PasswordResetRepository
+	requests ResetRequestRepository
+
+	// без способа доставки (nil) сброс пароля недоступен
+	notifier Notifier
+
+	// после смены пароля все сессии пользователя завершаются
+	sessions []SessionRevoker
+}
+
+func NewPasswordService(
+	tx transaction.TxManager,
+	users UserRepository,
+	resets PasswordResetRepository,
+	requests ResetRequestRepository,
+	notifier Notifier,
+	sessions ...SessionRevoker,
+) *PasswordService {
+	return &PasswordService{
+		tx:       tx,
+		users:    users,
+		resets:   resets,
+		requests: requests,
+		notifier: notifier,
+		sessions: sessions,
+	}
+}
+
+// ChangePassword меняет пароль пользователя, знающего текущий пароль
+func (s *PasswordService) ChangePassword(ctx context.Context, userID uuid.UUID, current, password string) error {
+	user, err := s.users.FindByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(current)) != nil {
+		return ErrInvalidCredentials
+	}
+
+	passwordHash, err := newPasswordHash(password)
+	if err != nil {
+		return err
+	}
+
+	return s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		return s.setPassword(ctx, userID, passwordHash)
+	})
+}
+
+// RequestReset отправляет пользователю токен сброса пароля. Чтобы по ответу нельзя было
+// узнать, зарегистрирован ли логин, для неизвестного логина ошибка не возвращается,
+// а ограничение частоты запросов действует для любого логина.
+func (s *PasswordService) RequestReset(ctx context.Context, login, ip string) error {
+	if s.notifier == nil {
+		return ErrResetDisabled
+	}
+
+	if err := s.throttleReset(ctx, login, ip, time.Now()); err != nil {
+		return err
+	}
+
+	user, err := s.users.FindByLogin(ctx, login)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	token, err := randomToken()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	reset := model.PasswordReset{
+		ID:        uuid.New(),
+		UserID:    user.ID,
+		Hash:      hashToken(token),
+		CreatedAt: now,
+		ExpiresAt: now.Add(ResetDuration),
+	}
+	if err := s.resets.Create(ctx, reset); err != nil {
+		return err
+	}
+
+	return s.notifier.NotifyPasswordReset(ctx, user, token, reset.ExpiresAt)
+}
+
+// ResetPassword устанавливает новый пароль по токену сброса, токен используется один раз
+func (s *PasswordService) ResetPassword(ctx context.Context, token, password string) error {
+	passwordHash, err := newPasswordHash(password)
+	if err != nil {
+		return err
+	}
+
+	// погашение токена, смена пароля и завершение сессий выполняются вместе
+	return s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		reset, err := s.resets.FindByHash(ctx, hashToken(token))
+		if errors.Is(err, storage.ErrNotFound) {
+			return ErrInvalidResetToken
+		}
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if !reset.Active(now) {
+			return ErrInvalidResetToken
+		}
+
+		// токен мог быть использован параллельным запросом
+		err = s.resets.MarkUsed(ctx, reset.ID, now)
+		if errors.Is(err, storage.ErrConflict) {
+			return ErrInvalidResetToken
+		}
+		if err != nil {
+			return err
+		}
+
+		return s.setPassword(ctx, reset.UserID, passwordHash)
+	})
+}
+
+// setPassword сохраняет хэш нового пароля, отзывает неиспользованные токены сброса
+// и завершает все сессии пользователя. Вызывается внутри транзакции.
+func (s *PasswordService) setPassword(ctx context.Context, userID uuid.UUID, passwordHash string) error {
+	if err := s.users.UpdatePassword(ctx, userID, passwordHash); err != nil {
+		return err
+	}
+
+	if err := s.resets.RevokeUser(ctx, userID, time.Now()); err != nil {
+		return err
+	}
+
+	for _, sessions := range s.sessions {
+		if err := sessions.RevokeAll(ctx, userID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// throttleReset учитывает запрос сброса и возвращает *LockedError, если запросов с этим
+// логином или с этого адреса за окно было слишком много
+func (s *PasswordService) throttleReset(ctx context.Context, login, ip string, now time.Time) error {
+	// запрос учитывается в обоих счётчиках, даже если первый уже превышен
+	exceeded := false
+	for _, limit := range []struct {
+		key      string
+		requests int
+	}{
+		{key: resetLoginKey(login), requests: loginResetRequests},
+		{key: resetIPKey(ip), requests: ipResetRequests},
+	} {
+		requests, err := s.requests.AddFailure(ctx, limit.key, now, now.Add(-resetWindow))
+		if err != nil {
+			return err
+		}
+		exceeded = exceeded || requests > limit.requests
+	}
+
+	if exceeded {
+		return &LockedError{RetryAfter: resetWindow}
+	}
+
+	return nil
+}
+
+// newPasswordHash проверяет и хэширует новый пароль до начала транзакции: bcrypt работает долго
+func newPasswordHash(password string) (string, error) {
+	if password == "" {
+		return "", ErrEmptyPassword
+	}
+
+	return hashPassword(password)
+}
+
+func resetLoginKey(login string) string {
+	return "reset:login:" + login
+}
+
+func resetIPKey(ip string) string {
+	return "reset:ip:" + ip
+}
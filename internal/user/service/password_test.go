@@ -0,0 +1,164 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	txMock "github.com/yury-kuznetsov/gofermart/internal/transaction/mock"
+	"github.com/yury-kuznetsov/gofermart/internal/user/mock"
+	"github.com/yury-kuznetsov/gofermart/internal/user/model"
+	"golang.org/x/crypto/bcrypt"
+	"testing"
+	"time"
+)
+
+// recordingNotifier запоминает отправленные токены сброса пароля
+type recordingNotifier struct {
+	tokens map[string]string
+}
+
+func (n *recordingNotifier) NotifyPasswordReset(_ context.Context, user model.User, token string, _ time.Time) error {
+	if n.tokens == nil {
+		n.tokens = make(map[string]string)
+	}
+	n.tokens[user.Login] = token
+	return nil
+}
+
+// recordingRevoker запоминает пользователей, чьи сессии были завершены
+type recordingRevoker struct {
+	revoked []uuid.UUID
+}
+
+func (r *recordingRevoker) RevokeAll(_ context.Context, userID uuid.UUID) error {
+	r.revoked = append(r.revoked, userID)
+	return nil
+}
+
+func newPasswordService(t *testing.T) (*PasswordService, *recordingNotifier, *recordingRevoker, uuid.UUID) {
+	users := &mock.UserRepo{}
+	userID, err := users.Create(context.Background(), "user", createPassword("old"))
+	require.NoError(t, err)
+
+	notifier := &recordingNotifier{}
+	revoker := &recordingRevoker{}
+	svc := NewPasswordService(
+		&txMock.TxManager{},
+		users,
+		&mock.PasswordResetRepo{},
+		&mock.LoginAttemptRepo{},
+		notifier,
+		revoker,
+	)
+	return svc, notifier, revoker, userID
+}
+
+func assertPassword(t *testing.T, s *PasswordService, userID uuid.UUID, password string) {
+	user, err := s.users.FindByID(context.Background(), userID)
+	require.NoError(t, err)
+	assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)))
+}
+
+func TestChangePassword(t *testing.T) {
+	ctx := context.Background()
+	svc, _, revoker, userID := newPasswordService(t)
+
+	// без текущего пароля сменить пароль нельзя
+	assert.ErrorIs(t, svc.ChangePassword(ctx, userID, "wrong", "new"), ErrInvalidCredentials)
+	assert.ErrorIs(t, svc.ChangePassword(ctx, userID, "old", ""), ErrEmptyPassword)
+	assertPassword(t, svc, userID, "old")
+	assert.Empty(t, revoker.revoked)
+
+	require.NoError(t, svc.ChangePassword(ctx, userID, "old", "new"))
+	assertPassword(t, svc, userID, "new")
+	assert.Equal(t, []uuid.UUID{userID}, revoker.revoked)
+}
+
+func TestResetPassword(t *testing.T) {
+	ctx := context.Background()
+	svc, notifier, revoker, userID := newPasswordService(t)
+
+	// для неизвестного логина ничего не отправляется, но и ошибки нет
+	require.NoError(t, svc.RequestReset(ctx, "stranger", "127.0.0.1"))
+	assert.Empty(t, notifier.tokens)
+
+	require.NoError(t, svc.RequestReset(ctx, "user", "127.0.0.1"))
+	token := notifier.tokens["user"]
+	require.NotEmpty(t, token)
+
+	assert.ErrorIs(t, svc.ResetPassword(ctx, "wrong", "new"), ErrInvalidResetToken)
+	assert.ErrorIs(t, svc.ResetPassword(ctx, token, ""), ErrEmptyPassword)
+
+	require.NoError(t, svc.ResetPassword(ctx, token, "new"))
+	assertPassword(t, svc, userID, "new")
+	assert.Equal(t, []uuid.UUID{userID}, revoker.revoked)
+
+	// токен одноразовый
+	assert.ErrorIs(t, svc.ResetPassword(ctx, token, "another"), ErrInvalidResetToken)
+	assertPassword(t, svc, userID, "new")
+}
+
+func TestResetPasswordExpired(t *testing.T) {
+	ctx := context.Background()
+	svc, _, _, userID := newPasswordService(t)
+
+	expired := model.PasswordReset{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Hash:      hashToken("expired"),
+		CreatedAt: time.Now().Add(-2 * ResetDuration),
+		ExpiresAt: time.Now().Add(-ResetDuration),
+	}
+	require.NoError(t, svc.resets.Create(ctx, expired))
+
+	assert.ErrorIs(t, svc.ResetPassword(ctx, "expired", "new"), ErrInvalidResetToken)
+	assertPassword(t, svc, userID, "old")
+}
+
+func TestResetPasswordRevokesOtherTokens(t *testing.T) {
+	ctx := context.Background()
+	svc, notifier, _, userID := newPasswordService(t)
+
+	require.NoError(t, svc.RequestReset(ctx, "user", "127.0.0.1"))
+	first := notifier.tokens["user"]
+	require.NoError(t, svc.RequestReset(ctx, "user", "127.0.0.1"))
+	second := notifier.tokens["user"]
+
+	// после смены пароля прежние токены сброса больше не действуют
+	require.NoError(t, svc.ChangePassword(ctx, userID, "old", "new"))
+	assert.ErrorIs(t, svc.ResetPassword(ctx, first, "another"), ErrInvalidResetToken)
+	assert.ErrorIs(t, svc.ResetPassword(ctx, second, "another"), ErrInvalidResetToken)
+	assertPassword(t, svc, userID, "new")
+}
+
+func TestRequestResetThrottled(t *testing.T) {
+	ctx := context.Background()
+	svc, notifier, _, _ := newPasswordService(t)
+
+	// ограничение действует и для неизвестных логинов, чтобы не выдавать зарегистрированные
+	for _, login := range []string{"user", "stranger"} {
+		for i := 0; i < loginResetRequests; i++ {
+			require.NoError(t, svc.RequestReset(ctx, login, "127.0.0.1"))
+		}
+
+		var locked *LockedError
+		err := svc.RequestReset(ctx, login, "127.0.0.1")
+		require.ErrorAs(t, err, &locked)
+		assert.ErrorIs(t, err, ErrTooManyAttempts)
+		assert.Equal(t, resetWindow, locked.RetryAfter)
+	}
+
+	// с одного адреса можно запросить сброс для разных логинов, но не без предела
+	for i := 0; i < ipResetRequests-2*(loginResetRequests+1); i++ {
+		require.NoError(t, svc.RequestReset(ctx, fmt.Sprint("login", i), "127.0.0.1"))
+	}
+	assert.ErrorIs(t, svc.RequestReset(ctx, "another", "127.0.0.1"), ErrTooManyAttempts)
+	assert.Len(t, notifier.tokens, 1)
+}
+
+func TestRequestResetDisabled(t *testing.T) {
+	svc := NewPasswordService(&txMock.TxManager{}, &mock.UserRepo{}, &mock.PasswordResetRepo{}, &mock.LoginAttemptRepo{}, nil)
+	assert.ErrorIs(t, svc.RequestReset(context.Background(), "user", "127.0.0.1"), ErrResetDisabled)
+}
@@ -0,0 +1,135 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/yury-kuznetsov/gofermart/internal/storage"
+	"github.com/yury-kuznetsov/gofermart/internal/transaction"
+	"github.com/yury-kuznetsov/gofermart/internal/user/model"
+	"time"
+)
+
+// RefreshDuration - срок действия токена обновления
+const RefreshDuration = 30 * 24 * time.Hour
+
+var ErrInvalidRefreshToken = errors.New("недействительный токен обновления")
+var ErrRefreshTokenReused = errors.New("токен обновления использован повторно, все сессии семейства отозваны")
+
+type RefreshTokenRepository interface {
+	Create(ctx context.Context, token model.RefreshToken) error
+	FindByHash(ctx context.Context, hash string) (model.RefreshToken, error)
+	MarkUsed(ctx context.Context, id uuid.UUID, at time.Time) error
+	RevokeFamily(ctx context.Context, familyID uuid.UUID, at time.Time) error
+	RevokeUser(ctx context.Context, userID uuid.UUID, at time.Time) error
+}
+
+// Session - сессия пользователя, начатая входом. Её идентификатор совпадает
+// с семейством токенов обновления и передаётся в токенах доступа.
+type Session struct {
+	ID           uuid.UUID
+	UserID       uuid.UUID
+	RefreshToken string
+}
+
+type RefreshService struct {
+	tx transaction.TxManager
+	r  RefreshTokenRepository
+}
+
+func NewRefreshService(tx transaction.TxManager, repository RefreshTokenRepository) *RefreshService {
+	return &RefreshService{tx: tx, r: repository}
+}
+
+// Issue выпускает токен обновления для новой сессии пользователя
+func (s *RefreshService) Issue(ctx context.Context, userID uuid.UUID, device model.Device) (Session, error) {
+	return s.issue(ctx, userID, uuid.New(), device)
+}
+
+// Rotate обменивает токен обновления на новый из того же семейства.
+// Повторное предъявление уже обменянного токена означает, что он украден:
+// в этом случае отзывается всё семейство, и сессию придётся начать заново.
+func (s *RefreshService) Rotate(ctx context.Context, raw string, device model.Device) (Session, error) {
+	var session Session
+	var reused bool
+
+	// обмен выполняется целиком или не выполняется: старый токен не погасится без выпуска нового
+	err := s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		var err error
+		session, reused, err = s.rotate(ctx, raw, device)
+		return err
+	})
+	if err != nil {
+		return Session{}, err
+	}
+
+	// отзыв семейства фиксируется вместе с транзакцией, поэтому ошибка возвращается после неё
+	if reused {
+		return Session{}, ErrRefreshTokenReused
+	}
+
+	return session, nil
+}
+
+func (s *RefreshService) rotate(ctx context.Context, raw string, device model.Device) (Session, bool, error) {
+	token, err := s.r.FindByHash(ctx, hashToken(raw))
+	if errors.Is(err, storage.ErrNotFound) {
+		return Session{}, false, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return Session{}, false, err
+	}
+
+	now := time.Now()
+	switch {
+	case token.RevokedAt != nil, !now.Before(token.ExpiresAt):
+		return Session{}, false, ErrInvalidRefreshToken
+	case token.UsedAt != nil:
+		return Session{}, true, s.r.RevokeFamily(ctx, token.FamilyID, now)
+	}
+
+	// токен мог быть обменян параллельным запросом с тем же токеном
+	err = s.r.MarkUsed(ctx, token.ID, now)
+	if errors.Is(err, storage.ErrConflict) {
+		return Session{}, true, s.r.RevokeFamily(ctx, token.FamilyID, now)
+	}
+	if err != nil {
+		return Session{}, false, err
+	}
+
+	session, err := s.issue(ctx, token.UserID, token.FamilyID, device)
+	return session, false, err
+}
+
+// RevokeSession завершает сессию: её токены обновления больше не обмениваются
+func (s *RefreshService) RevokeSession(ctx context.Context, sessionID uuid.UUID) error {
+	return s.r.RevokeFamily(ctx, sessionID, time.Now())
+}
+
+// RevokeAll завершает все сессии пользователя
+func (s *RefreshService) RevokeAll(ctx context.Context, userID uuid.UUID) error {
+	return s.r.RevokeUser(ctx, userID, time.Now())
+}
+
+func (s *RefreshService) issue(ctx context.Context, userID, familyID uuid.UUID, device model.Device) (Session, error) {
+	token, err := randomToken()
+	if err != nil {
+		return Session{}, err
+	}
+
+	now := time.Now()
+	err = s.r.Create(ctx, model.RefreshToken{
+		ID:        uuid.New(),
+		UserID:    userID,
+		FamilyID:  familyID,
+		Hash:      hashToken(token),
+		Device:    device,
+		CreatedAt: now,
+		ExpiresAt: now.Add(RefreshDuration),
+	})
+	if err != nil {
+		return Session{}, err
+	}
+
+	return Session{ID: familyID, UserID: userID, RefreshToken: token}, nil
+}
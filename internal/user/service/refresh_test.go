@@ -0,0 +1,126 @@
+package service
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	txMock "github.com/yury-kuznetsov/gofermart/internal/transaction/mock"
+	"github.com/yury-kuznetsov/gofermart/internal/user/mock"
+	"github.com/yury-kuznetsov/gofermart/internal/user/model"
+	"testing"
+	"time"
+)
+
+var device = model.Device{UserAgent: "test", IP: "127.0.0.1"}
+
+func TestRefreshRotate(t *testing.T) {
+	ctx := context.Background()
+	repo := &mock.RefreshTokenRepo{}
+	svc := NewRefreshService(&txMock.TxManager{}, repo)
+	userID := uuid.New()
+
+	first, err := svc.Issue(ctx, userID, device)
+	require.NoError(t, err)
+	assert.Equal(t, userID, first.UserID)
+
+	// хранится только хэш токена
+	_, err = repo.FindByHash(ctx, first.RefreshToken)
+	assert.Error(t, err)
+	stored, err := repo.FindByHash(ctx, hashToken(first.RefreshToken))
+	require.NoError(t, err)
+	assert.Equal(t, userID, stored.UserID)
+	assert.Equal(t, first.ID, stored.FamilyID)
+	assert.Equal(t, device, stored.Device)
+
+	// новый токен продолжает ту же сессию
+	second, err := svc.Rotate(ctx, first.RefreshToken, device)
+	require.NoError(t, err)
+	assert.Equal(t, userID, second.UserID)
+	assert.Equal(t, first.ID, second.ID)
+	assert.NotEqual(t, first.RefreshToken, second.RefreshToken)
+
+	_, err = svc.Rotate(ctx, second.RefreshToken, device)
+	assert.NoError(t, err)
+}
+
+func TestRefreshReuse(t *testing.T) {
+	ctx := context.Background()
+	repo := &mock.RefreshTokenRepo{}
+	svc := NewRefreshService(&txMock.TxManager{}, repo)
+
+	userID := uuid.New()
+
+	// другая сессия того же пользователя не затрагивается
+	other, err := svc.Issue(ctx, userID, device)
+	require.NoError(t, err)
+
+	first, err := svc.Issue(ctx, userID, device)
+	require.NoError(t, err)
+	second, err := svc.Rotate(ctx, first.RefreshToken, device)
+	require.NoError(t, err)
+
+	// повторное предъявление обменянного токена отзывает всё семейство
+	_, err = svc.Rotate(ctx, first.RefreshToken, device)
+	assert.ErrorIs(t, err, ErrRefreshTokenReused)
+
+	_, err = svc.Rotate(ctx, second.RefreshToken, device)
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+
+	_, err = svc.Rotate(ctx, other.RefreshToken, device)
+	assert.NoError(t, err)
+}
+
+func TestRefreshInvalid(t *testing.T) {
+	ctx := context.Background()
+	repo := &mock.RefreshTokenRepo{}
+	svc := NewRefreshService(&txMock.TxManager{}, repo)
+
+	_, err := svc.Rotate(ctx, "unknown", device)
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+
+	// просроченный токен
+	expired := model.RefreshToken{
+		ID:        uuid.New(),
+		UserID:    uuid.New(),
+		FamilyID:  uuid.New(),
+		Hash:      hashToken("expired"),
+		CreatedAt: time.Now().Add(-2 * RefreshDuration),
+		ExpiresAt: time.Now().Add(-RefreshDuration),
+	}
+	require.NoError(t, repo.Create(ctx, expired))
+
+	_, err = svc.Rotate(ctx, "expired", device)
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+}
+
+func TestRefreshRevoke(t *testing.T) {
+	ctx := context.Background()
+	svc := NewRefreshService(&txMock.TxManager{}, &mock.RefreshTokenRepo{})
+	userID := uuid.New()
+
+	first, err := svc.Issue(ctx, userID, device)
+	require.NoError(t, err)
+	second, err := svc.Issue(ctx, userID, device)
+	require.NoError(t, err)
+	third, err := svc.Issue(ctx, userID, device)
+	require.NoError(t, err)
+	stranger, err := svc.Issue(ctx, uuid.New(), device)
+	require.NoError(t, err)
+
+	// выход завершает только свою сессию
+	require.NoError(t, svc.RevokeSession(ctx, first.ID))
+	_, err = svc.Rotate(ctx, first.RefreshToken, device)
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+	second, err = svc.Rotate(ctx, second.RefreshToken, device)
+	assert.NoError(t, err)
+
+	// выход со всех устройств завершает все сессии пользователя
+	require.NoError(t, svc.RevokeAll(ctx, userID))
+	for _, session := range []Session{second, third} {
+		_, err = svc.Rotate(ctx, session.RefreshToken, device)
+		assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+	}
+	_, err = svc.Rotate(ctx, stranger.RefreshToken, device)
+	assert.NoError(t, err)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"github.com/google/uuid"
+	"github.com/yury-kuznetsov/gofermart/internal/storage"
 	"github.com/yury-kuznetsov/gofermart/internal/user/model"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -14,6 +15,8 @@ var ErrInvalidCredentials = errors.New("неверная пара логин/п
 type UserRepository interface {
 	Create(ctx context.Context, login, password string) (uuid.UUID, error)
 	FindByLogin(ctx context.Context, login string) (model.User, error)
+	FindByID(ctx context.Context, id uuid.UUID) (model.User, error)
+	UpdatePassword(ctx context.Context, id uuid.UUID, password string) error
 }
 
 type UserService struct {
@@ -26,26 +29,38 @@ func NewUserService(repository UserRepository) *UserService {
 
 func (s *UserService) Register(ctx context.Context, login, password string) (uuid.UUID, error) {
 	// проверяем наличие пользователя с таким логином
-	user, _ := s.r.FindByLogin(ctx, login)
-	if user.ID != uuid.Nil {
+	_, err := s.r.FindByLogin(ctx, login)
+	if err == nil {
 		return uuid.Nil, ErrUserExists
 	}
+	if !errors.Is(err, storage.ErrNotFound) {
+		return uuid.Nil, err
+	}
 
 	// подготавливаем пароль к хранению
-	passwordHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	passwordHash, err := hashPassword(password)
 	if err != nil {
-		return uuid.Nil, errors.New("ошибка при создании хэша пароля")
+		return uuid.Nil, err
 	}
 
-	return s.r.Create(ctx, login, string(passwordHash))
+	// логин могли занять параллельным запросом
+	id, err := s.r.Create(ctx, login, passwordHash)
+	if errors.Is(err, storage.ErrDuplicate) {
+		return uuid.Nil, ErrUserExists
+	}
+
+	return id, err
 }
 
 func (s *UserService) Login(ctx context.Context, login, password string) (uuid.UUID, error) {
 	// проверяем наличие пользователя с таким логином
 	user, err := s.r.FindByLogin(ctx, login)
-	if err != nil {
+	if errors.Is(err, storage.ErrNotFound) {
 		return uuid.Nil, ErrInvalidCredentials
 	}
+	if err != nil {
+		return uuid.Nil, err
+	}
 
 	// проверяем пароль
 	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
@@ -55,3 +70,12 @@ func (s *UserService) Login(ctx context.Context, login, password string) (uuid.U
 
 	return user.ID, nil
 }
+
+func hashPassword(password string) (string, error) {
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", errors.New("ошибка при создании хэша пароля")
+	}
+
+	return string(passwordHash), nil
+}
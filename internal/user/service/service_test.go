@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"github.com/google/uuid"
+	"github.com/yury-kuznetsov/gofermart/internal/storage"
 	"github.com/yury-kuznetsov/gofermart/internal/user/model"
 	"golang.org/x/crypto/bcrypt"
 	"testing"
@@ -19,7 +20,7 @@ func (m *mockUserRepository) FindByLogin(_ context.Context, login string) (model
 			return user, nil
 		}
 	}
-	return model.User{}, errors.New("user not found")
+	return model.User{}, storage.ErrNotFound
 }
 
 func (m *mockUserRepository) Create(_ context.Context, login, password string) (uuid.UUID, error) {
@@ -29,6 +30,25 @@ func (m *mockUserRepository) Create(_ context.Context, login, password string) (
 	return id, nil
 }
 
+func (m *mockUserRepository) FindByID(_ context.Context, id uuid.UUID) (model.User, error) {
+	for _, user := range m.users {
+		if user.ID == id {
+			return user, nil
+		}
+	}
+	return model.User{}, storage.ErrNotFound
+}
+
+func (m *mockUserRepository) UpdatePassword(_ context.Context, id uuid.UUID, password string) error {
+	for i, user := range m.users {
+		if user.ID == id {
+			m.users[i].Password = password
+			return nil
+		}
+	}
+	return storage.ErrNotFound
+}
+
 func createPassword(password string) string {
 	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	return string(hashedPassword)
@@ -88,3 +108,59 @@ func TestLogin(t *testing.T) {
 		})
 	}
 }
+
+// failingUserRepository имитирует недоступность базы данных
+type failingUserRepository struct{}
+
+func (failingUserRepository) FindByLogin(context.Context, string) (model.User, error) {
+	return model.User{}, errors.New("connection refused")
+}
+
+func (failingUserRepository) Create(context.Context, string, string) (uuid.UUID, error) {
+	return uuid.Nil, errors.New("connection refused")
+}
+
+func (failingUserRepository) FindByID(context.Context, uuid.UUID) (model.User, error) {
+	return model.User{}, errors.New("connection refused")
+}
+
+func (failingUserRepository) UpdatePassword(context.Context, uuid.UUID, string) error {
+	return errors.New("connection refused")
+}
+
+// duplicateUserRepository имитирует регистрацию того же логина параллельным запросом
+type duplicateUserRepository struct {
+	failingUserRepository
+}
+
+func (duplicateUserRepository) FindByLogin(context.Context, string) (model.User, error) {
+	return model.User{}, storage.ErrNotFound
+}
+
+func (duplicateUserRepository) Create(context.Context, string, string) (uuid.UUID, error) {
+	return uuid.Nil, storage.ErrDuplicate
+}
+
+func TestRepositoryFailure(t *testing.T) {
+	svc := UserService{r: failingUserRepository{}}
+
+	// сбой хранилища не выдаётся за занятый логин или неверный пароль
+	_, err := svc.Register(context.Background(), "test", "password")
+	if err == nil || errors.Is(err, ErrUserExists) {
+		t.Errorf("expected storage error, but got: %v", err)
+	}
+
+	_, err = svc.Login(context.Background(), "test", "password")
+	if err == nil || errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("expected storage error, but got: %v", err)
+	}
+}
+
+func TestRegisterConcurrentDuplicate(t *testing.T) {
+	svc := UserService{r: duplicateUserRepository{}}
+
+	_, err := svc.Register(context.Background(), "test", "password")
+	if !errors.Is(err, ErrUserExists) {
+		t.Errorf("expected error: %v, but got: %v", ErrUserExists, err)
+	}
+}
@@ -2,13 +2,15 @@ package middleware
 
 import (
 	"context"
+	"errors"
 	"github.com/google/uuid"
+	"github.com/yury-kuznetsov/gofermart/internal/user/service"
 	"net/http"
 	"strings"
 )
 
 type JWTService interface {
-	GetUserID(token string) uuid.UUID
+	GetUserID(ctx context.Context, token string) (uuid.UUID, error)
 }
 
 type key int
@@ -16,6 +18,7 @@ type key int
 const (
 	CookieKey     = "token"
 	keyUserID key = iota
+	keyToken
 )
 
 func AuthMiddleware(jwtService JWTService) func(next http.Handler) http.Handler {
@@ -28,15 +31,20 @@ func AuthMiddleware(jwtService JWTService) func(next http.Handler) http.Handler
 				return
 			}
 
-			// извлекаем идентификатор пользователя
-			userID := jwtService.GetUserID(tokenString)
-			if userID == uuid.Nil {
+			// извлекаем идентификатор пользователя, отозванные токены не принимаются
+			userID, err := jwtService.GetUserID(r.Context(), tokenString)
+			if errors.Is(err, service.ErrInvalidToken) {
 				http.Error(w, "Invalid token", http.StatusUnauthorized)
 				return
 			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
 
 			// передаем в контекст для обработчиков
 			ctx := context.WithValue(r.Context(), keyUserID, userID)
+			ctx = context.WithValue(ctx, keyToken, tokenString)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
@@ -66,3 +74,9 @@ func GetUserID(ctx context.Context) uuid.UUID {
 
 	return id
 }
+
+// GetToken возвращает токен, с которым пришёл запрос
+func GetToken(ctx context.Context) string {
+	token, _ := ctx.Value(keyToken).(string)
+	return token
+}
@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseTrustedProxies(t *testing.T) {
+	proxies, err := ParseTrustedProxies(" 10.0.0.1, 192.168.0.0/16,,::1 ")
+	require.NoError(t, err)
+	require.Len(t, proxies, 3)
+	assert.Equal(t, "10.0.0.1/32", proxies[0].String())
+	assert.Equal(t, "192.168.0.0/16", proxies[1].String())
+	assert.Equal(t, "::1/128", proxies[2].String())
+
+	_, err = ParseTrustedProxies("proxy.local")
+	assert.Error(t, err)
+}
+
+func TestRealIPMiddleware(t *testing.T) {
+	trusted, err := ParseTrustedProxies("10.0.0.0/8")
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		expected   string
+	}{
+		{
+			name:       "без прокси",
+			remoteAddr: "203.0.113.5:1234",
+			expected:   "203.0.113.5:1234",
+		},
+		{
+			name:       "заголовки от недоверенного адреса не учитываются",
+			remoteAddr: "203.0.113.5:1234",
+			headers:    map[string]string{"X-Forwarded-For": "198.51.100.1", "X-Real-IP": "198.51.100.2"},
+			expected:   "203.0.113.5:1234",
+		},
+		{
+			name:       "адрес клиента от доверенного прокси",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"X-Forwarded-For": "198.51.100.1"},
+			expected:   "198.51.100.1",
+		},
+		{
+			name:       "подставленные клиентом адреса левее не учитываются",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"X-Forwarded-For": "192.0.2.1, 198.51.100.1, 10.0.0.2"},
+			expected:   "198.51.100.1",
+		},
+		{
+			name:       "X-Real-IP без X-Forwarded-For",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"X-Real-IP": "198.51.100.2"},
+			expected:   "198.51.100.2",
+		},
+		{
+			name:       "некорректный заголовок",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"X-Forwarded-For": "unknown"},
+			expected:   "10.0.0.1:1234",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var remoteAddr string
+			handler := RealIPMiddleware(trusted)(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				remoteAddr = r.RemoteAddr
+			}))
+
+			r := httptest.NewRequest(http.MethodPost, "/api/user/login", nil)
+			r.RemoteAddr = tc.remoteAddr
+			for name, value := range tc.headers {
+				r.Header.Set(name, value)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), r)
+
+			assert.Equal(t, tc.expected, remoteAddr)
+		})
+	}
+}